@@ -0,0 +1,277 @@
+// Copyright (c) 2015, Roland Bali (roland.bali@spagettikod.se), Spagettikod
+// All rights reserved.
+//
+// Redistribution and use in source and binary forms, with or without modification,
+// are permitted provided that the following conditions are met:
+//
+// 1. Redistributions of source code must retain the above copyright notice, this
+//    list of conditions and the following disclaimer.
+//
+// 2. Redistributions in binary form must reproduce the above copyright notice, this
+//    list of conditions and the following disclaimer in the documentation and/or
+//    other materials provided with the distribution.
+//
+// 3. Neither the name of the copyright holder nor the names of its contributors may
+//    be used to endorse or promote products derived from this software without
+//    specific prior written permission.
+//
+// THIS SOFTWARE IS PROVIDED BY THE COPYRIGHT HOLDERS AND CONTRIBUTORS "AS IS" AND
+// ANY EXPRESS OR IMPLIED WARRANTIES, INCLUDING, BUT NOT LIMITED TO, THE IMPLIED
+// WARRANTIES OF MERCHANTABILITY AND FITNESS FOR A PARTICULAR PURPOSE ARE DISCLAIMED.
+// IN NO EVENT SHALL THE COPYRIGHT HOLDER OR CONTRIBUTORS BE LIABLE FOR ANY DIRECT,
+// INDIRECT, INCIDENTAL, SPECIAL, EXEMPLARY, OR CONSEQUENTIAL DAMAGES (INCLUDING, BUT
+// NOT LIMITED TO, PROCUREMENT OF SUBSTITUTE GOODS OR SERVICES; LOSS OF USE, DATA, OR
+// PROFITS; OR BUSINESS INTERRUPTION) HOWEVER CAUSED AND ON ANY THEORY OF LIABILITY,
+// WHETHER IN CONTRACT, STRICT LIABILITY, OR TORT (INCLUDING NEGLIGENCE OR OTHERWISE)
+// ARISING IN ANY WAY OUT OF THE USE OF THIS SOFTWARE, EVEN IF ADVISED OF THE
+// POSSIBILITY OF SUCH DAMAGE.
+
+package gotracer
+
+import "time"
+
+// Smoother smooths successive readings using an exponential moving average of
+// the voltage, current, power and temperature values. Energy counters, daily
+// extremes, SOC and load state are always taken from the latest reading since
+// averaging them makes no sense.
+type Smoother struct {
+	alpha float32
+	last  TracerStatus
+	init  bool
+}
+
+// NewSmoother returns a Smoother with smoothing factor alpha, between 0 and 1.
+// A higher alpha gives more weight to the latest reading.
+func NewSmoother(alpha float32) *Smoother {
+	return &Smoother{alpha: alpha}
+}
+
+// Smooth adds t to the moving average and returns the smoothed reading.
+func (s *Smoother) Smooth(t TracerStatus) TracerStatus {
+	if !s.init {
+		s.last = t
+		s.init = true
+		return t
+	}
+	ema := func(prev, cur float32) float32 {
+		return prev + s.alpha*(cur-prev)
+	}
+	p := s.last
+	t.ArrayVoltage = ema(p.ArrayVoltage, t.ArrayVoltage)
+	t.ArrayCurrent = ema(p.ArrayCurrent, t.ArrayCurrent)
+	t.ArrayPower = ema(p.ArrayPower, t.ArrayPower)
+	t.BatteryVoltage = ema(p.BatteryVoltage, t.BatteryVoltage)
+	t.BatteryCurrent = ema(p.BatteryCurrent, t.BatteryCurrent)
+	t.BatteryTemp = ema(p.BatteryTemp, t.BatteryTemp)
+	t.DeviceTemp = ema(p.DeviceTemp, t.DeviceTemp)
+	t.HeatsinkTemp = ema(p.HeatsinkTemp, t.HeatsinkTemp)
+	t.LoadVoltage = ema(p.LoadVoltage, t.LoadVoltage)
+	t.LoadCurrent = ema(p.LoadCurrent, t.LoadCurrent)
+	t.LoadPower = ema(p.LoadPower, t.LoadPower)
+	s.last = t
+	return t
+}
+
+// SumStatus combines readings from several controllers into one reading for the
+// whole site. Currents, powers and energy counters are summed. Voltages, SOC and
+// temperatures are not additive and are averaged instead, for example the battery
+// voltage of controllers sharing a battery bank. Load values are summed and
+// averaged over the readings with a load only. Load, array over voltage, an
+// abnormal battery status and charging faults are set if they are set for any of
+// the controllers. The timestamp, NoLoad and LoadState are those of the latest
+// reading.
+func SumStatus(readings []TracerStatus) TracerStatus {
+	var s TracerStatus
+	if len(readings) == 0 {
+		return s
+	}
+	var soc int32
+	latest := readings[0]
+	for _, r := range readings {
+		s.ArrayVoltage += r.ArrayVoltage
+		s.ArrayCurrent += r.ArrayCurrent
+		s.ArrayPower += r.ArrayPower
+		s.ArrayOverVoltage = s.ArrayOverVoltage || r.ArrayOverVoltage
+		s.BatteryVoltage += r.BatteryVoltage
+		s.BatteryCurrent += r.BatteryCurrent
+		soc += r.BatterySOC
+		s.BatteryTemp += r.BatteryTemp
+		s.BatteryMaxVoltage += r.BatteryMaxVoltage
+		s.BatteryMinVoltage += r.BatteryMinVoltage
+		s.DeviceTemp += r.DeviceTemp
+		s.HeatsinkTemp += r.HeatsinkTemp
+		if !r.NoLoad {
+			s.LoadVoltage += r.LoadVoltage
+			s.LoadCurrent += r.LoadCurrent
+			s.LoadPower += r.LoadPower
+		}
+		s.Load = s.Load || r.Load
+		if r.BatteryStatus != (BatteryStatus{}) {
+			s.BatteryStatus = r.BatteryStatus
+		}
+		if r.ChargingFaults != (ChargingFaults{}) {
+			s.ChargingFaults = r.ChargingFaults
+		}
+		s.EnergyConsumedDaily += r.EnergyConsumedDaily
+		s.EnergyConsumedMonthly += r.EnergyConsumedMonthly
+		s.EnergyConsumedAnnual += r.EnergyConsumedAnnual
+		s.EnergyConsumedTotal += r.EnergyConsumedTotal
+		s.EnergyGeneratedDaily += r.EnergyGeneratedDaily
+		s.EnergyGeneratedMonthly += r.EnergyGeneratedMonthly
+		s.EnergyGeneratedAnnual += r.EnergyGeneratedAnnual
+		s.EnergyGeneratedTotal += r.EnergyGeneratedTotal
+		if r.Timestamp.After(latest.Timestamp) {
+			latest = r
+		}
+	}
+	s.Timestamp, s.NoLoad, s.LoadState = latest.Timestamp, latest.NoLoad, latest.LoadState
+	n := float32(len(readings))
+	s.ArrayVoltage /= n
+	s.BatteryVoltage /= n
+	s.BatterySOC = soc / int32(len(readings))
+	s.BatteryTemp /= n
+	s.BatteryMaxVoltage /= n
+	s.BatteryMinVoltage /= n
+	s.DeviceTemp /= n
+	s.HeatsinkTemp /= n
+	if loads := withLoad(readings); loads > 0 {
+		s.LoadVoltage /= float32(loads)
+	}
+	return s
+}
+
+// Counts the readings of controllers with a load terminal.
+func withLoad(readings []TracerStatus) (n int) {
+	for _, r := range readings {
+		if !r.NoLoad {
+			n++
+		}
+	}
+	return
+}
+
+// Downsampler reduces the rate of readings by averaging all readings within an
+// interval into one. Energy counters, daily extremes and states are taken from
+// the last reading in the interval rather than averaged. The timestamp of an
+// averaged reading is the start of its interval.
+type Downsampler struct {
+	interval time.Duration
+	start    time.Time
+	readings []TracerStatus
+}
+
+// NewDownsampler returns a Downsampler averaging readings over interval.
+func NewDownsampler(interval time.Duration) *Downsampler {
+	return &Downsampler{interval: interval}
+}
+
+// Add adds t to its interval. When t starts a new interval the average of the
+// previous interval is returned and ok is true.
+func (d *Downsampler) Add(t TracerStatus) (avg TracerStatus, ok bool) {
+	start := t.Timestamp.Truncate(d.interval)
+	if len(d.readings) > 0 && !start.Equal(d.start) {
+		avg, ok = d.Flush()
+	}
+	d.start = start
+	d.readings = append(d.readings, t)
+	return
+}
+
+// Flush returns the average of the readings added so far to the current interval
+// and starts over. ok is false if there are no readings.
+func (d *Downsampler) Flush() (avg TracerStatus, ok bool) {
+	if len(d.readings) == 0 {
+		return
+	}
+	avg = average(d.readings)
+	avg.Timestamp = d.start
+	d.readings = d.readings[:0]
+	return avg, true
+}
+
+// Averages readings, values that are not gauges are taken from the last reading.
+func average(readings []TracerStatus) TracerStatus {
+	a := SumStatus(readings)
+	n := float32(len(readings))
+	a.ArrayCurrent /= n
+	a.ArrayPower /= n
+	a.BatteryCurrent /= n
+	if loads := withLoad(readings); loads > 0 {
+		a.LoadCurrent /= float32(loads)
+		a.LoadPower /= float32(loads)
+	}
+
+	last := readings[len(readings)-1]
+	a.ArrayOverVoltage = last.ArrayOverVoltage
+	a.BatteryMaxVoltage = last.BatteryMaxVoltage
+	a.BatteryMinVoltage = last.BatteryMinVoltage
+	a.Load = last.Load
+	a.NoLoad = last.NoLoad
+	a.BatteryStatus = last.BatteryStatus
+	a.LoadState = last.LoadState
+	a.ChargingFaults = last.ChargingFaults
+	a.EnergyConsumedDaily = last.EnergyConsumedDaily
+	a.EnergyConsumedMonthly = last.EnergyConsumedMonthly
+	a.EnergyConsumedAnnual = last.EnergyConsumedAnnual
+	a.EnergyConsumedTotal = last.EnergyConsumedTotal
+	a.EnergyGeneratedDaily = last.EnergyGeneratedDaily
+	a.EnergyGeneratedMonthly = last.EnergyGeneratedMonthly
+	a.EnergyGeneratedAnnual = last.EnergyGeneratedAnnual
+	a.EnergyGeneratedTotal = last.EnergyGeneratedTotal
+	return a
+}
+
+// DetectRollover returns the names of the energy counters that are lower in cur
+// than in prev, meaning they have been reset between the readings, typically at
+// the end of a day, month or year. When accumulating energy over longer periods
+// the previous value of such a counter should be carried forward instead of
+// subtracting it from the current value.
+func DetectRollover(prev, cur TracerStatus) []string {
+	counters := []struct {
+		name      string
+		prev, cur float32
+	}{
+		{"EnergyConsumedDaily", prev.EnergyConsumedDaily, cur.EnergyConsumedDaily},
+		{"EnergyConsumedMonthly", prev.EnergyConsumedMonthly, cur.EnergyConsumedMonthly},
+		{"EnergyConsumedAnnual", prev.EnergyConsumedAnnual, cur.EnergyConsumedAnnual},
+		{"EnergyConsumedTotal", prev.EnergyConsumedTotal, cur.EnergyConsumedTotal},
+		{"EnergyGeneratedDaily", prev.EnergyGeneratedDaily, cur.EnergyGeneratedDaily},
+		{"EnergyGeneratedMonthly", prev.EnergyGeneratedMonthly, cur.EnergyGeneratedMonthly},
+		{"EnergyGeneratedAnnual", prev.EnergyGeneratedAnnual, cur.EnergyGeneratedAnnual},
+		{"EnergyGeneratedTotal", prev.EnergyGeneratedTotal, cur.EnergyGeneratedTotal},
+	}
+	var names []string
+	for _, c := range counters {
+		if c.cur < c.prev {
+			names = append(names, c.name)
+		}
+	}
+	return names
+}
+
+// Array voltage, (V), a reading must be above or below the threshold by for
+// ClassifyDayNight to switch between day and night.
+const dayNightHysteresis = 0.5
+
+// ClassifyDayNight tells for each of readings, in time order, whether it was
+// made during the day, judged by the array voltage. It switches to day once the
+// voltage rises above threshold by 0.5 V and to night once it falls below it by
+// as much, so a voltage hovering around threshold at dusk does not flap. A
+// threshold between the night and day threshold voltages of ArraySettings
+// matches the Tracer. The first reading is day if it is above threshold.
+func ClassifyDayNight(readings []TracerStatus, threshold float32) []bool {
+	day := make([]bool, len(readings))
+	for i, r := range readings {
+		switch {
+		case i == 0:
+			day[i] = r.ArrayVoltage > threshold
+		case r.ArrayVoltage > threshold+dayNightHysteresis:
+			day[i] = true
+		case r.ArrayVoltage < threshold-dayNightHysteresis:
+			day[i] = false
+		default:
+			day[i] = day[i-1]
+		}
+	}
+	return day
+}
@@ -0,0 +1,172 @@
+// Copyright (c) 2015, Roland Bali (roland.bali@spagettikod.se), Spagettikod
+// All rights reserved.
+//
+// Redistribution and use in source and binary forms, with or without modification,
+// are permitted provided that the following conditions are met:
+//
+// 1. Redistributions of source code must retain the above copyright notice, this
+//    list of conditions and the following disclaimer.
+//
+// 2. Redistributions in binary form must reproduce the above copyright notice, this
+//    list of conditions and the following disclaimer in the documentation and/or
+//    other materials provided with the distribution.
+//
+// 3. Neither the name of the copyright holder nor the names of its contributors may
+//    be used to endorse or promote products derived from this software without
+//    specific prior written permission.
+//
+// THIS SOFTWARE IS PROVIDED BY THE COPYRIGHT HOLDERS AND CONTRIBUTORS "AS IS" AND
+// ANY EXPRESS OR IMPLIED WARRANTIES, INCLUDING, BUT NOT LIMITED TO, THE IMPLIED
+// WARRANTIES OF MERCHANTABILITY AND FITNESS FOR A PARTICULAR PURPOSE ARE DISCLAIMED.
+// IN NO EVENT SHALL THE COPYRIGHT HOLDER OR CONTRIBUTORS BE LIABLE FOR ANY DIRECT,
+// INDIRECT, INCIDENTAL, SPECIAL, EXEMPLARY, OR CONSEQUENTIAL DAMAGES (INCLUDING, BUT
+// NOT LIMITED TO, PROCUREMENT OF SUBSTITUTE GOODS OR SERVICES; LOSS OF USE, DATA, OR
+// PROFITS; OR BUSINESS INTERRUPTION) HOWEVER CAUSED AND ON ANY THEORY OF LIABILITY,
+// WHETHER IN CONTRACT, STRICT LIABILITY, OR TORT (INCLUDING NEGLIGENCE OR OTHERWISE)
+// ARISING IN ANY WAY OUT OF THE USE OF THIS SOFTWARE, EVEN IF ADVISED OF THE
+// POSSIBILITY OF SUCH DAMAGE.
+
+package gotracer
+
+import (
+	"reflect"
+	"testing"
+	"time"
+)
+
+func TestSumStatusLoad(t *testing.T) {
+	now := time.Now()
+	readings := []TracerStatus{
+		{LoadVoltage: 24, LoadCurrent: 2, LoadPower: 48, Load: true, LoadState: LoadOn, Timestamp: now.Add(-time.Second)},
+		{LoadVoltage: 12, LoadCurrent: 1, LoadPower: 12, LoadState: LoadOffManual, Timestamp: now},
+		{NoLoad: true, LoadState: LoadUnknown, Timestamp: now.Add(-2 * time.Second)},
+	}
+	s := SumStatus(readings)
+	if s.LoadVoltage != 18 || s.LoadCurrent != 3 || s.LoadPower != 60 {
+		t.Errorf("load %.2f V %.2f A %.2f W, want 18 V 3 A 60 W", s.LoadVoltage, s.LoadCurrent, s.LoadPower)
+	}
+	if s.NoLoad || s.LoadState != LoadOffManual || !s.Timestamp.Equal(now) {
+		t.Errorf("NoLoad %t, LoadState %v and timestamp %v, want those of the latest reading", s.NoLoad, s.LoadState, s.Timestamp)
+	}
+
+	a := average(readings)
+	if a.LoadCurrent != 1.5 || a.LoadPower != 30 {
+		t.Errorf("average load %.2f A %.2f W, want 1.5 A 30 W", a.LoadCurrent, a.LoadPower)
+	}
+}
+
+func TestSmoother(t *testing.T) {
+	sm := NewSmoother(0.5)
+	tests := []struct {
+		in, want TracerStatus
+	}{
+		{TracerStatus{ArrayVoltage: 10, BatteryCurrent: 2, EnergyGeneratedDaily: 1, BatterySOC: 50},
+			TracerStatus{ArrayVoltage: 10, BatteryCurrent: 2, EnergyGeneratedDaily: 1, BatterySOC: 50}},
+		{TracerStatus{ArrayVoltage: 20, BatteryCurrent: -2, EnergyGeneratedDaily: 2, BatterySOC: 60},
+			TracerStatus{ArrayVoltage: 15, BatteryCurrent: 0, EnergyGeneratedDaily: 2, BatterySOC: 60}},
+		{TracerStatus{ArrayVoltage: 15, BatteryCurrent: 4, EnergyGeneratedDaily: 3, BatterySOC: 70},
+			TracerStatus{ArrayVoltage: 15, BatteryCurrent: 2, EnergyGeneratedDaily: 3, BatterySOC: 70}},
+	}
+	for i, tt := range tests {
+		if got := sm.Smooth(tt.in); got != tt.want {
+			t.Errorf("reading %d smoothed to %+v, want %+v", i, got, tt.want)
+		}
+	}
+}
+
+func TestSumStatus(t *testing.T) {
+	now := time.Now()
+	tests := []struct {
+		name     string
+		readings []TracerStatus
+		want     TracerStatus
+	}{
+		{"none", nil, TracerStatus{}},
+		{"summed and averaged", []TracerStatus{
+			{ArrayVoltage: 30, ArrayCurrent: 2, ArrayPower: 60, BatteryVoltage: 12, BatteryCurrent: 3, BatterySOC: 80, BatteryTemp: 20, EnergyGeneratedDaily: 1, Timestamp: now},
+			{ArrayVoltage: 40, ArrayCurrent: 1, ArrayPower: 40, BatteryVoltage: 13, BatteryCurrent: -1, BatterySOC: 90, BatteryTemp: 24, EnergyGeneratedDaily: 2, ArrayOverVoltage: true, Timestamp: now.Add(-time.Second)},
+		}, TracerStatus{ArrayVoltage: 35, ArrayCurrent: 3, ArrayPower: 100, BatteryVoltage: 12.5, BatteryCurrent: 2, BatterySOC: 85, BatteryTemp: 22, EnergyGeneratedDaily: 3, ArrayOverVoltage: true, Timestamp: now}},
+		{"no load terminals", []TracerStatus{
+			{NoLoad: true, LoadState: LoadUnknown, Timestamp: now.Add(-time.Second)},
+			{NoLoad: true, LoadState: LoadUnknown, Timestamp: now},
+		}, TracerStatus{NoLoad: true, LoadState: LoadUnknown, Timestamp: now}},
+		{"latest without load terminal", []TracerStatus{
+			{LoadVoltage: 12, LoadCurrent: 1, LoadPower: 12, Load: true, LoadState: LoadOn, Timestamp: now.Add(-time.Second)},
+			{NoLoad: true, LoadState: LoadUnknown, Timestamp: now},
+		}, TracerStatus{LoadVoltage: 12, LoadCurrent: 1, LoadPower: 12, Load: true, NoLoad: true, LoadState: LoadUnknown, Timestamp: now}},
+	}
+	for _, tt := range tests {
+		if got := SumStatus(tt.readings); !reflect.DeepEqual(got, tt.want) {
+			t.Errorf("%s: got\n%+v\nwant\n%+v", tt.name, got, tt.want)
+		}
+	}
+}
+
+func TestDownsampler(t *testing.T) {
+	start := time.Date(2024, 3, 2, 12, 0, 0, 0, time.UTC)
+	d := NewDownsampler(time.Minute)
+	if _, ok := d.Flush(); ok {
+		t.Error("empty interval flushed")
+	}
+	steps := []struct {
+		in   TracerStatus
+		ok   bool
+		want TracerStatus
+	}{
+		{in: TracerStatus{ArrayCurrent: 2, BatteryVoltage: 12, EnergyGeneratedDaily: 1, LoadState: LoadOn, Timestamp: start.Add(10 * time.Second)}},
+		{in: TracerStatus{ArrayCurrent: 4, BatteryVoltage: 13, EnergyGeneratedDaily: 2, LoadState: LoadOffTimer, Timestamp: start.Add(40 * time.Second)}},
+		{in: TracerStatus{ArrayCurrent: 6, BatteryVoltage: 14, EnergyGeneratedDaily: 3, Timestamp: start.Add(65 * time.Second)},
+			ok: true, want: TracerStatus{ArrayCurrent: 3, BatteryVoltage: 12.5, EnergyGeneratedDaily: 2, LoadState: LoadOffTimer, Timestamp: start}},
+	}
+	for i, s := range steps {
+		avg, ok := d.Add(s.in)
+		if ok != s.ok || !reflect.DeepEqual(avg, s.want) {
+			t.Errorf("reading %d gave %+v, %t, want %+v, %t", i, avg, ok, s.want, s.ok)
+		}
+	}
+	avg, ok := d.Flush()
+	if want := (TracerStatus{ArrayCurrent: 6, BatteryVoltage: 14, EnergyGeneratedDaily: 3, Timestamp: start.Add(time.Minute)}); !ok || !reflect.DeepEqual(avg, want) {
+		t.Errorf("flush gave %+v, %t, want %+v", avg, ok, want)
+	}
+}
+
+func TestDetectRollover(t *testing.T) {
+	prev := TracerStatus{EnergyGeneratedDaily: 5, EnergyGeneratedMonthly: 50, EnergyConsumedDaily: 1, EnergyGeneratedTotal: 500}
+	tests := []struct {
+		cur  TracerStatus
+		want []string
+	}{
+		{prev, nil},
+		{TracerStatus{EnergyGeneratedDaily: 6, EnergyGeneratedMonthly: 51, EnergyConsumedDaily: 1, EnergyGeneratedTotal: 501}, nil},
+		{TracerStatus{EnergyGeneratedDaily: 0, EnergyGeneratedMonthly: 50, EnergyConsumedDaily: 0, EnergyGeneratedTotal: 500}, []string{"EnergyConsumedDaily", "EnergyGeneratedDaily"}},
+		{TracerStatus{EnergyGeneratedTotal: 500}, []string{"EnergyConsumedDaily", "EnergyGeneratedDaily", "EnergyGeneratedMonthly"}},
+	}
+	for _, tt := range tests {
+		if got := DetectRollover(prev, tt.cur); !reflect.DeepEqual(got, tt.want) {
+			t.Errorf("rollover to %+v gave %v, want %v", tt.cur, got, tt.want)
+		}
+	}
+}
+
+func TestClassifyDayNight(t *testing.T) {
+	tests := []struct {
+		voltages []float32
+		want     []bool
+	}{
+		{nil, []bool{}},
+		{[]float32{10.2}, []bool{true}},
+		{[]float32{10}, []bool{false}},
+		// Within 0.5 V of the threshold the previous state is kept.
+		{[]float32{9, 10.4, 10.5, 10.6, 9.8, 9.5, 9.4}, []bool{false, false, false, true, true, true, false}},
+		{[]float32{12, 9.7, 12, 5}, []bool{true, true, true, false}},
+	}
+	for _, tt := range tests {
+		readings := make([]TracerStatus, len(tt.voltages))
+		for i, v := range tt.voltages {
+			readings[i].ArrayVoltage = v
+		}
+		if got := ClassifyDayNight(readings, 10); !reflect.DeepEqual(got, tt.want) {
+			t.Errorf("voltages %v classified as day %v, want %v", tt.voltages, got, tt.want)
+		}
+	}
+}
@@ -0,0 +1,104 @@
+// Copyright (c) 2015, Roland Bali (roland.bali@spagettikod.se), Spagettikod
+// All rights reserved.
+//
+// Redistribution and use in source and binary forms, with or without modification,
+// are permitted provided that the following conditions are met:
+//
+// 1. Redistributions of source code must retain the above copyright notice, this
+//    list of conditions and the following disclaimer.
+//
+// 2. Redistributions in binary form must reproduce the above copyright notice, this
+//    list of conditions and the following disclaimer in the documentation and/or
+//    other materials provided with the distribution.
+//
+// 3. Neither the name of the copyright holder nor the names of its contributors may
+//    be used to endorse or promote products derived from this software without
+//    specific prior written permission.
+//
+// THIS SOFTWARE IS PROVIDED BY THE COPYRIGHT HOLDERS AND CONTRIBUTORS "AS IS" AND
+// ANY EXPRESS OR IMPLIED WARRANTIES, INCLUDING, BUT NOT LIMITED TO, THE IMPLIED
+// WARRANTIES OF MERCHANTABILITY AND FITNESS FOR A PARTICULAR PURPOSE ARE DISCLAIMED.
+// IN NO EVENT SHALL THE COPYRIGHT HOLDER OR CONTRIBUTORS BE LIABLE FOR ANY DIRECT,
+// INDIRECT, INCIDENTAL, SPECIAL, EXEMPLARY, OR CONSEQUENTIAL DAMAGES (INCLUDING, BUT
+// NOT LIMITED TO, PROCUREMENT OF SUBSTITUTE GOODS OR SERVICES; LOSS OF USE, DATA, OR
+// PROFITS; OR BUSINESS INTERRUPTION) HOWEVER CAUSED AND ON ANY THEORY OF LIABILITY,
+// WHETHER IN CONTRACT, STRICT LIABILITY, OR TORT (INCLUDING NEGLIGENCE OR OTHERWISE)
+// ARISING IN ANY WAY OUT OF THE USE OF THIS SOFTWARE, EVEN IF ADVISED OF THE
+// POSSIBILITY OF SUCH DAMAGE.
+
+package gotracer
+
+import "time"
+
+// AlertRule raises an alert when a value of the reading crosses Trigger and
+// clears it only once the value has crossed back past Clear. The gap between
+// the two keeps a value hovering around the threshold from raising and clearing
+// the alert over and over. An alert on a value rising too high has Clear below
+// Trigger, an alert on a value falling too low has Clear above it.
+type AlertRule struct {
+	Name    string
+	Value   func(TracerStatus) float32
+	Trigger float32
+	Clear   float32
+}
+
+// Reports whether the rule triggers on value v.
+func (r AlertRule) triggers(v float32) bool {
+	if r.Clear > r.Trigger {
+		return v < r.Trigger
+	}
+	return v > r.Trigger
+}
+
+// Reports whether the rule clears on value v.
+func (r AlertRule) clears(v float32) bool {
+	if r.Clear > r.Trigger {
+		return v > r.Clear
+	}
+	return v < r.Clear
+}
+
+// Alert is a change of the state of an alert rule.
+type Alert struct {
+	Rule      string    `json:"rule"`   // Name of the rule
+	Active    bool      `json:"active"` // Alert was raised, false when it was cleared
+	Value     float32   `json:"value"`  // Value that changed the state
+	Timestamp time.Time `json:"t"`      // Time of the reading
+}
+
+// AlertTracker keeps the state of alert rules between readings and reports
+// only when an alert is raised or cleared.
+type AlertTracker struct {
+	rules  []AlertRule
+	active []bool
+}
+
+// NewAlertTracker returns an AlertTracker for rules with all alerts cleared.
+func NewAlertTracker(rules ...AlertRule) *AlertTracker {
+	return &AlertTracker{rules: rules, active: make([]bool, len(rules))}
+}
+
+// Update checks t against the rules and returns the alerts raised or cleared by
+// it, none if no state changed.
+func (a *AlertTracker) Update(t TracerStatus) []Alert {
+	var changes []Alert
+	for i, r := range a.rules {
+		v := r.Value(t)
+		if a.active[i] && r.clears(v) || !a.active[i] && r.triggers(v) {
+			a.active[i] = !a.active[i]
+			changes = append(changes, Alert{Rule: r.Name, Active: a.active[i], Value: v, Timestamp: t.Timestamp})
+		}
+	}
+	return changes
+}
+
+// Active returns the names of the rules whose alert is currently raised.
+func (a *AlertTracker) Active() []string {
+	var names []string
+	for i, r := range a.rules {
+		if a.active[i] {
+			names = append(names, r.Name)
+		}
+	}
+	return names
+}
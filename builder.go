@@ -0,0 +1,149 @@
+// Copyright (c) 2015, Roland Bali (roland.bali@spagettikod.se), Spagettikod
+// All rights reserved.
+//
+// Redistribution and use in source and binary forms, with or without modification,
+// are permitted provided that the following conditions are met:
+//
+// 1. Redistributions of source code must retain the above copyright notice, this
+//    list of conditions and the following disclaimer.
+//
+// 2. Redistributions in binary form must reproduce the above copyright notice, this
+//    list of conditions and the following disclaimer in the documentation and/or
+//    other materials provided with the distribution.
+//
+// 3. Neither the name of the copyright holder nor the names of its contributors may
+//    be used to endorse or promote products derived from this software without
+//    specific prior written permission.
+//
+// THIS SOFTWARE IS PROVIDED BY THE COPYRIGHT HOLDERS AND CONTRIBUTORS "AS IS" AND
+// ANY EXPRESS OR IMPLIED WARRANTIES, INCLUDING, BUT NOT LIMITED TO, THE IMPLIED
+// WARRANTIES OF MERCHANTABILITY AND FITNESS FOR A PARTICULAR PURPOSE ARE DISCLAIMED.
+// IN NO EVENT SHALL THE COPYRIGHT HOLDER OR CONTRIBUTORS BE LIABLE FOR ANY DIRECT,
+// INDIRECT, INCIDENTAL, SPECIAL, EXEMPLARY, OR CONSEQUENTIAL DAMAGES (INCLUDING, BUT
+// NOT LIMITED TO, PROCUREMENT OF SUBSTITUTE GOODS OR SERVICES; LOSS OF USE, DATA, OR
+// PROFITS; OR BUSINESS INTERRUPTION) HOWEVER CAUSED AND ON ANY THEORY OF LIABILITY,
+// WHETHER IN CONTRACT, STRICT LIABILITY, OR TORT (INCLUDING NEGLIGENCE OR OTHERWISE)
+// ARISING IN ANY WAY OUT OF THE USE OF THIS SOFTWARE, EVEN IF ADVISED OF THE
+// POSSIBILITY OF SUCH DAMAGE.
+
+package gotracer
+
+import "time"
+
+// StatusBuilder builds a TracerStatus for tests and examples, setting only the
+// values of interest. Unset values default to an idle 12 V system at 25 C with
+// the battery half charged, and powers not set are calculated from voltage and
+// current, so a built reading passes Validate and CheckConsistency.
+type StatusBuilder struct {
+	t                     TracerStatus
+	arrayPower, loadPower bool
+}
+
+// NewStatusBuilder returns a StatusBuilder with the default values, timestamped
+// with the current time.
+func NewStatusBuilder() *StatusBuilder {
+	return &StatusBuilder{t: TracerStatus{
+		BatteryVoltage:    12.8,
+		BatterySOC:        50,
+		BatteryTemp:       25,
+		BatteryMaxVoltage: 12.8,
+		BatteryMinVoltage: 12.8,
+		DeviceTemp:        25,
+		Timestamp:         time.Now().UTC(),
+	}}
+}
+
+// Array sets the array voltage and current.
+func (b *StatusBuilder) Array(voltage, current float32) *StatusBuilder {
+	b.t.ArrayVoltage, b.t.ArrayCurrent = voltage, current
+	return b
+}
+
+// ArrayPower sets the array power instead of calculating it.
+func (b *StatusBuilder) ArrayPower(power float32) *StatusBuilder {
+	b.t.ArrayPower, b.arrayPower = power, true
+	return b
+}
+
+// BatteryVoltage sets the battery voltage, widening the daily extremes to
+// include it.
+func (b *StatusBuilder) BatteryVoltage(voltage float32) *StatusBuilder {
+	b.t.BatteryVoltage = voltage
+	if voltage > b.t.BatteryMaxVoltage {
+		b.t.BatteryMaxVoltage = voltage
+	}
+	if voltage < b.t.BatteryMinVoltage {
+		b.t.BatteryMinVoltage = voltage
+	}
+	return b
+}
+
+// BatteryCurrent sets the battery current, negative when discharging.
+func (b *StatusBuilder) BatteryCurrent(current float32) *StatusBuilder {
+	b.t.BatteryCurrent = current
+	return b
+}
+
+// SOC sets the battery state of charge.
+func (b *StatusBuilder) SOC(soc int32) *StatusBuilder {
+	b.t.BatterySOC = soc
+	return b
+}
+
+// Temps sets the battery and device temperatures.
+func (b *StatusBuilder) Temps(battery, device float32) *StatusBuilder {
+	b.t.BatteryTemp, b.t.DeviceTemp = battery, device
+	return b
+}
+
+// Load turns the load on with voltage and current, or off if current is 0.
+func (b *StatusBuilder) Load(voltage, current float32) *StatusBuilder {
+	b.t.LoadVoltage, b.t.LoadCurrent = voltage, current
+	b.t.Load = current != 0
+	b.t.LoadState = LoadOffManual
+	if b.t.Load {
+		b.t.LoadState = LoadOn
+	}
+	return b
+}
+
+// LoadPower sets the load power instead of calculating it.
+func (b *StatusBuilder) LoadPower(power float32) *StatusBuilder {
+	b.t.LoadPower, b.loadPower = power, true
+	return b
+}
+
+// NoLoad makes the reading that of a controller without a load terminal.
+func (b *StatusBuilder) NoLoad() *StatusBuilder {
+	b.t.NoLoad = true
+	return b
+}
+
+// Energy sets the daily, monthly, annual and total energy counters to the same
+// consumed and generated values.
+func (b *StatusBuilder) Energy(consumed, generated float32) *StatusBuilder {
+	t := &b.t
+	t.EnergyConsumedDaily, t.EnergyConsumedMonthly, t.EnergyConsumedAnnual, t.EnergyConsumedTotal = consumed, consumed, consumed, consumed
+	t.EnergyGeneratedDaily, t.EnergyGeneratedMonthly, t.EnergyGeneratedAnnual, t.EnergyGeneratedTotal = generated, generated, generated, generated
+	return b
+}
+
+// Timestamp sets the time of the reading.
+func (b *StatusBuilder) Timestamp(ts time.Time) *StatusBuilder {
+	b.t.Timestamp = ts
+	return b
+}
+
+// Build returns the reading.
+func (b *StatusBuilder) Build() TracerStatus {
+	t := b.t
+	if !b.arrayPower {
+		t.ArrayPower = t.ArrayVoltage * t.ArrayCurrent
+	}
+	if t.NoLoad {
+		t.LoadVoltage, t.LoadCurrent, t.LoadPower, t.Load, t.LoadState = 0, 0, 0, false, LoadUnknown
+	} else if !b.loadPower {
+		t.LoadPower = t.LoadVoltage * t.LoadCurrent
+	}
+	return t
+}
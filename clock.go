@@ -0,0 +1,142 @@
+// Copyright (c) 2015, Roland Bali (roland.bali@spagettikod.se), Spagettikod
+// All rights reserved.
+//
+// Redistribution and use in source and binary forms, with or without modification,
+// are permitted provided that the following conditions are met:
+//
+// 1. Redistributions of source code must retain the above copyright notice, this
+//    list of conditions and the following disclaimer.
+//
+// 2. Redistributions in binary form must reproduce the above copyright notice, this
+//    list of conditions and the following disclaimer in the documentation and/or
+//    other materials provided with the distribution.
+//
+// 3. Neither the name of the copyright holder nor the names of its contributors may
+//    be used to endorse or promote products derived from this software without
+//    specific prior written permission.
+//
+// THIS SOFTWARE IS PROVIDED BY THE COPYRIGHT HOLDERS AND CONTRIBUTORS "AS IS" AND
+// ANY EXPRESS OR IMPLIED WARRANTIES, INCLUDING, BUT NOT LIMITED TO, THE IMPLIED
+// WARRANTIES OF MERCHANTABILITY AND FITNESS FOR A PARTICULAR PURPOSE ARE DISCLAIMED.
+// IN NO EVENT SHALL THE COPYRIGHT HOLDER OR CONTRIBUTORS BE LIABLE FOR ANY DIRECT,
+// INDIRECT, INCIDENTAL, SPECIAL, EXEMPLARY, OR CONSEQUENTIAL DAMAGES (INCLUDING, BUT
+// NOT LIMITED TO, PROCUREMENT OF SUBSTITUTE GOODS OR SERVICES; LOSS OF USE, DATA, OR
+// PROFITS; OR BUSINESS INTERRUPTION) HOWEVER CAUSED AND ON ANY THEORY OF LIABILITY,
+// WHETHER IN CONTRACT, STRICT LIABILITY, OR TORT (INCLUDING NEGLIGENCE OR OTHERWISE)
+// ARISING IN ANY WAY OUT OF THE USE OF THIS SOFTWARE, EVEN IF ADVISED OF THE
+// POSSIBILITY OF SUCH DAMAGE.
+
+package gotracer
+
+import (
+	"io"
+	"time"
+)
+
+// Real time clock holding registers.
+const regClock = 0x9013 // Seconds and minutes, hour and day, month and year
+
+// Number of attempts to read the daily energy within one device day.
+const dailyEnergyAttempts = 3
+
+// ReadClock reads the real time clock of the Tracer connected on specified
+// portName. The clock has no time zone, its wall clock time is returned in
+// time.Local.
+func ReadClock(portName string, opts ...Option) (c time.Time, err error) {
+	err = withPort(portName, opts, func(port io.ReadWriter, cfg config) error {
+		c, err = readClock(port, cfg)
+		return err
+	})
+	return
+}
+
+func readClock(port io.ReadWriter, cfg config) (time.Time, error) {
+	regs, err := readRegisters(port, cfg, funcReadHoldingRegisters, regClock, 3)
+	if err != nil {
+		return time.Time{}, err
+	}
+	// Each register holds two values, the high byte and the low byte.
+	sec, min := int(regs[0]&0xff), int(regs[0]>>8)
+	hour, day := int(regs[1]&0xff), int(regs[1]>>8)
+	month, year := time.Month(regs[2]&0xff), 2000+int(regs[2]>>8)
+	return time.Date(year, month, day, hour, min, sec, 0, time.Local), nil
+}
+
+// DailyEnergy contain the daily energy counters together with the Tracer clock
+// when they were read. The Tracer resets the daily counters at midnight by its
+// own clock, Clock tells which device day the counters belong to.
+type DailyEnergy struct {
+	EnergyConsumedDaily  float32   `json:"ecd"`   // Tracer calculated daily consumption, (kWh)
+	EnergyGeneratedDaily float32   `json:"egd"`   // Tracer calculated daily power generation, (kWh)
+	Clock                time.Time `json:"clock"` // Tracer clock when the counters were read
+}
+
+// ReadDailyEnergy reads the daily energy counters and the clock from the Tracer
+// connected on specified portName. The clock is read before and after the
+// counters, if the device day changed in between the counters are read again.
+func ReadDailyEnergy(portName string, opts ...Option) (e DailyEnergy, err error) {
+	err = withPort(portName, opts, func(port io.ReadWriter, cfg config) error {
+		// The fifth status command reads the extremes and energy counters.
+		c := queryStateCommand[4]
+		for i := 0; i < dailyEnergyAttempts; i++ {
+			before, err := readClock(port, cfg)
+			if err != nil {
+				return err
+			}
+			buffer := make([]byte, statusBufferSize)
+			if err := query(port, cfg, buffer, c); err != nil {
+				return err
+			}
+			after, err := readClock(port, cfg)
+			if err != nil {
+				return err
+			}
+
+			r, err := decodeRaw(buffer)
+			if err != nil {
+				return err
+			}
+			t := r.Scaled()
+			e = DailyEnergy{EnergyConsumedDaily: t.EnergyConsumedDaily, EnergyGeneratedDaily: t.EnergyGeneratedDaily, Clock: after}
+			if before.YearDay() == after.YearDay() {
+				break
+			}
+		}
+		return nil
+	})
+	return
+}
+
+// ReadDayCounter reads the number of days the Tracer connected on specified
+// portName has been running, which would tell the device day independent of
+// its clock.
+//
+// The BN series keeps no such counter in any register known to be readable,
+// so ErrNotSupported is always returned for now. ReadDailyEnergy pairs the
+// daily counters with the device clock instead.
+func ReadDayCounter(portName string, opts ...Option) (int, error) {
+	return 0, ErrNotSupported
+}
+
+// NextDailyReset returns when the Tracer resets its daily counters after the
+// reading was made, the following midnight in loc, the time zone the device
+// clock is set to. The Tracer resets by its own clock, which may drift, see
+// ReadClock.
+func (t TracerStatus) NextDailyReset(loc *time.Location) time.Time {
+	ts := t.Timestamp.In(loc)
+	return time.Date(ts.Year(), ts.Month(), ts.Day()+1, 0, 0, 0, 0, loc)
+}
+
+// NextMonthlyReset returns when the Tracer resets its monthly counters after the
+// reading was made, midnight at the start of the following month in loc.
+func (t TracerStatus) NextMonthlyReset(loc *time.Location) time.Time {
+	ts := t.Timestamp.In(loc)
+	return time.Date(ts.Year(), ts.Month()+1, 1, 0, 0, 0, 0, loc)
+}
+
+// NextAnnualReset returns when the Tracer resets its annual counters after the
+// reading was made, midnight at the start of the following year in loc.
+func (t TracerStatus) NextAnnualReset(loc *time.Location) time.Time {
+	ts := t.Timestamp.In(loc)
+	return time.Date(ts.Year()+1, time.January, 1, 0, 0, 0, 0, loc)
+}
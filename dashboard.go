@@ -0,0 +1,101 @@
+// Copyright (c) 2015, Roland Bali (roland.bali@spagettikod.se), Spagettikod
+// All rights reserved.
+//
+// Redistribution and use in source and binary forms, with or without modification,
+// are permitted provided that the following conditions are met:
+//
+// 1. Redistributions of source code must retain the above copyright notice, this
+//    list of conditions and the following disclaimer.
+//
+// 2. Redistributions in binary form must reproduce the above copyright notice, this
+//    list of conditions and the following disclaimer in the documentation and/or
+//    other materials provided with the distribution.
+//
+// 3. Neither the name of the copyright holder nor the names of its contributors may
+//    be used to endorse or promote products derived from this software without
+//    specific prior written permission.
+//
+// THIS SOFTWARE IS PROVIDED BY THE COPYRIGHT HOLDERS AND CONTRIBUTORS "AS IS" AND
+// ANY EXPRESS OR IMPLIED WARRANTIES, INCLUDING, BUT NOT LIMITED TO, THE IMPLIED
+// WARRANTIES OF MERCHANTABILITY AND FITNESS FOR A PARTICULAR PURPOSE ARE DISCLAIMED.
+// IN NO EVENT SHALL THE COPYRIGHT HOLDER OR CONTRIBUTORS BE LIABLE FOR ANY DIRECT,
+// INDIRECT, INCIDENTAL, SPECIAL, EXEMPLARY, OR CONSEQUENTIAL DAMAGES (INCLUDING, BUT
+// NOT LIMITED TO, PROCUREMENT OF SUBSTITUTE GOODS OR SERVICES; LOSS OF USE, DATA, OR
+// PROFITS; OR BUSINESS INTERRUPTION) HOWEVER CAUSED AND ON ANY THEORY OF LIABILITY,
+// WHETHER IN CONTRACT, STRICT LIABILITY, OR TORT (INCLUDING NEGLIGENCE OR OTHERWISE)
+// ARISING IN ANY WAY OUT OF THE USE OF THIS SOFTWARE, EVEN IF ADVISED OF THE
+// POSSIBILITY OF SUCH DAMAGE.
+
+package gotracer
+
+import (
+	"fmt"
+	"strings"
+)
+
+const (
+	dashboardWidth = 44 // Width inside the box
+	gaugeWidth     = 20 // Width of bar gauges
+)
+
+// Dashboard renders the reading as a compact boxed dashboard with bar gauges for
+// SOC and power, suitable for a terminal. The power gauges show array and load
+// power relative to the larger of the two. The load values are left out when the
+// controller has no load terminal.
+func (t TracerStatus) Dashboard() string {
+	maxPower := t.ArrayPower
+	if !t.NoLoad && t.LoadPower > maxPower {
+		maxPower = t.LoadPower
+	}
+
+	lines := []string{
+		fmt.Sprintf("Array    %6.2f V %6.2f A %7.2f W", t.ArrayVoltage, t.ArrayCurrent, t.ArrayPower),
+		fmt.Sprintf("Battery  %6.2f V %6.2f A %6.2f C", t.BatteryVoltage, t.BatteryCurrent, t.BatteryTemp),
+	}
+	if !t.NoLoad {
+		lines = append(lines, fmt.Sprintf("Load     %6.2f V %6.2f A %7.2f W", t.LoadVoltage, t.LoadCurrent, t.LoadPower))
+	}
+	lines = append(lines,
+		"",
+		fmt.Sprintf("SOC   %s %4d %%", gauge(float32(t.BatterySOC), 100), t.BatterySOC),
+		fmt.Sprintf("Array %s %6.1f W", gauge(t.ArrayPower, maxPower), t.ArrayPower),
+	)
+	if !t.NoLoad {
+		lines = append(lines, fmt.Sprintf("Load  %s %6.1f W", gauge(t.LoadPower, maxPower), t.LoadPower))
+	}
+	lines = append(lines, "", fmt.Sprintf("Today    %.2f kWh generated, %.2f kWh used", t.EnergyGeneratedDaily, t.EnergyConsumedDaily))
+	if t.NoLoad {
+		lines = append(lines, fmt.Sprintf("Device %.2f C", t.DeviceTemp))
+	} else {
+		lines = append(lines, fmt.Sprintf("Load %s, device %.2f C", onOff(t.Load), t.DeviceTemp))
+	}
+
+	var b strings.Builder
+	b.WriteString("┌" + strings.Repeat("─", dashboardWidth+2) + "┐\n")
+	for _, l := range lines {
+		fmt.Fprintf(&b, "│ %-*s │\n", dashboardWidth, l)
+	}
+	b.WriteString("└" + strings.Repeat("─", dashboardWidth+2) + "┘\n")
+	return b.String()
+}
+
+// Draws a bar gauge of value relative to max.
+func gauge(value, max float32) string {
+	n := 0
+	if max > 0 {
+		n = int(value / max * gaugeWidth)
+	}
+	if n < 0 {
+		n = 0
+	} else if n > gaugeWidth {
+		n = gaugeWidth
+	}
+	return "[" + strings.Repeat("█", n) + strings.Repeat("░", gaugeWidth-n) + "]"
+}
+
+func onOff(on bool) string {
+	if on {
+		return "on"
+	}
+	return "off"
+}
@@ -0,0 +1,130 @@
+// Copyright (c) 2015, Roland Bali (roland.bali@spagettikod.se), Spagettikod
+// All rights reserved.
+//
+// Redistribution and use in source and binary forms, with or without modification,
+// are permitted provided that the following conditions are met:
+//
+// 1. Redistributions of source code must retain the above copyright notice, this
+//    list of conditions and the following disclaimer.
+//
+// 2. Redistributions in binary form must reproduce the above copyright notice, this
+//    list of conditions and the following disclaimer in the documentation and/or
+//    other materials provided with the distribution.
+//
+// 3. Neither the name of the copyright holder nor the names of its contributors may
+//    be used to endorse or promote products derived from this software without
+//    specific prior written permission.
+//
+// THIS SOFTWARE IS PROVIDED BY THE COPYRIGHT HOLDERS AND CONTRIBUTORS "AS IS" AND
+// ANY EXPRESS OR IMPLIED WARRANTIES, INCLUDING, BUT NOT LIMITED TO, THE IMPLIED
+// WARRANTIES OF MERCHANTABILITY AND FITNESS FOR A PARTICULAR PURPOSE ARE DISCLAIMED.
+// IN NO EVENT SHALL THE COPYRIGHT HOLDER OR CONTRIBUTORS BE LIABLE FOR ANY DIRECT,
+// INDIRECT, INCIDENTAL, SPECIAL, EXEMPLARY, OR CONSEQUENTIAL DAMAGES (INCLUDING, BUT
+// NOT LIMITED TO, PROCUREMENT OF SUBSTITUTE GOODS OR SERVICES; LOSS OF USE, DATA, OR
+// PROFITS; OR BUSINESS INTERRUPTION) HOWEVER CAUSED AND ON ANY THEORY OF LIABILITY,
+// WHETHER IN CONTRACT, STRICT LIABILITY, OR TORT (INCLUDING NEGLIGENCE OR OTHERWISE)
+// ARISING IN ANY WAY OUT OF THE USE OF THIS SOFTWARE, EVEN IF ADVISED OF THE
+// POSSIBILITY OF SUCH DAMAGE.
+
+package gotracer
+
+import "time"
+
+const (
+	// Array power, (W), below which derived values based on it are not calculated.
+	minArrayPower = 0.5
+	// Battery current, (A), below which the battery is considered idle.
+	minBatteryCurrent = 0.05
+)
+
+// ConversionEfficiency returns the estimated efficiency of the controller as the
+// output power, battery charging power plus load power, divided by the array
+// power. The second return value is false when array power is too low for the
+// estimate to be meaningful, for example at night.
+func (t TracerStatus) ConversionEfficiency() (float32, bool) {
+	if t.ArrayPower < minArrayPower {
+		return 0, false
+	}
+	out := t.BatteryVoltage*t.BatteryCurrent + t.LoadPower
+	return out / t.ArrayPower, true
+}
+
+// TimeToFull estimates the time until the battery is fully charged from the
+// battery current, SOC and the battery capacity given in Ah. The second return
+// value is false if the battery is not charging.
+func (t TracerStatus) TimeToFull(capacityAh float32) (time.Duration, bool) {
+	if t.BatteryCurrent < minBatteryCurrent {
+		return 0, false
+	}
+	remaining := capacityAh * float32(100-t.BatterySOC) / 100
+	return hours(remaining / t.BatteryCurrent), true
+}
+
+// TimeToEmpty estimates the time until the battery is empty from the battery
+// current, SOC and the battery capacity given in Ah. The second return value is
+// false if the battery is not discharging.
+func (t TracerStatus) TimeToEmpty(capacityAh float32) (time.Duration, bool) {
+	if t.BatteryCurrent > -minBatteryCurrent {
+		return 0, false
+	}
+	remaining := capacityAh * float32(t.BatterySOC) / 100
+	return hours(remaining / -t.BatteryCurrent), true
+}
+
+// EquivalentCycles estimates the number of full charge and discharge cycles the
+// battery has gone through, as the average of the total generated and consumed
+// energy divided by the battery capacity given in Wh. Energy the load draws
+// directly from the array is counted too, so the estimate is on the high side.
+// ControlSettings.CapacityWh gives the capacity from the settings.
+func (t TracerStatus) EquivalentCycles(capacityWh float32) float32 {
+	if capacityWh <= 0 {
+		return 0
+	}
+	throughput := (t.EnergyGeneratedTotal + t.EnergyConsumedTotal) / 2 * 1000 // kWh to Wh
+	return throughput / capacityWh
+}
+
+// VoltageBasedSOC estimates the state of charge from the battery voltage as its
+// position between the empty and full voltages, for example the low voltage
+// disconnect and boost voltage of BatterySettings, clamped to 0-100%. Battery
+// voltage also depends on the current and temperature so it is a crude
+// estimate, meant for batteries where the SOC of the Tracer is unreliable.
+func (t TracerStatus) VoltageBasedSOC(empty, full float32) float32 {
+	if full <= empty {
+		return 0
+	}
+	soc := (t.BatteryVoltage - empty) / (full - empty) * 100
+	if soc < 0 {
+		return 0
+	}
+	if soc > 100 {
+		return 100
+	}
+	return soc
+}
+
+// LowTempChargeCutoff reports whether charging appears to be held back because
+// the battery is too cold: the battery temperature is low while the array
+// voltage is above the battery voltage but the array delivers no power. The BN
+// series has no status flag of its own for this, so it is inferred from the
+// reading.
+func (t TracerStatus) LowTempChargeCutoff() bool {
+	return t.BatteryStatus.TempState == BatteryLowTemp && t.ArrayVoltage > t.BatteryVoltage && t.ArrayPower < minArrayPower
+}
+
+func hours(h float32) time.Duration {
+	return time.Duration(float64(h) * float64(time.Hour))
+}
+
+// FillDerivedPower sets ArrayPower and LoadPower to voltage times current when
+// they are zero while both voltage and current are not, recovering the power of
+// a partial reading where the power was not read. A reading without a load
+// terminal keeps its load power.
+func (t *TracerStatus) FillDerivedPower() {
+	if t.ArrayPower == 0 && t.ArrayVoltage != 0 && t.ArrayCurrent != 0 {
+		t.ArrayPower = t.ArrayVoltage * t.ArrayCurrent
+	}
+	if !t.NoLoad && t.LoadPower == 0 && t.LoadVoltage != 0 && t.LoadCurrent != 0 {
+		t.LoadPower = t.LoadVoltage * t.LoadCurrent
+	}
+}
@@ -0,0 +1,397 @@
+// Copyright (c) 2015, Roland Bali (roland.bali@spagettikod.se), Spagettikod
+// All rights reserved.
+//
+// Redistribution and use in source and binary forms, with or without modification,
+// are permitted provided that the following conditions are met:
+//
+// 1. Redistributions of source code must retain the above copyright notice, this
+//    list of conditions and the following disclaimer.
+//
+// 2. Redistributions in binary form must reproduce the above copyright notice, this
+//    list of conditions and the following disclaimer in the documentation and/or
+//    other materials provided with the distribution.
+//
+// 3. Neither the name of the copyright holder nor the names of its contributors may
+//    be used to endorse or promote products derived from this software without
+//    specific prior written permission.
+//
+// THIS SOFTWARE IS PROVIDED BY THE COPYRIGHT HOLDERS AND CONTRIBUTORS "AS IS" AND
+// ANY EXPRESS OR IMPLIED WARRANTIES, INCLUDING, BUT NOT LIMITED TO, THE IMPLIED
+// WARRANTIES OF MERCHANTABILITY AND FITNESS FOR A PARTICULAR PURPOSE ARE DISCLAIMED.
+// IN NO EVENT SHALL THE COPYRIGHT HOLDER OR CONTRIBUTORS BE LIABLE FOR ANY DIRECT,
+// INDIRECT, INCIDENTAL, SPECIAL, EXEMPLARY, OR CONSEQUENTIAL DAMAGES (INCLUDING, BUT
+// NOT LIMITED TO, PROCUREMENT OF SUBSTITUTE GOODS OR SERVICES; LOSS OF USE, DATA, OR
+// PROFITS; OR BUSINESS INTERRUPTION) HOWEVER CAUSED AND ON ANY THEORY OF LIABILITY,
+// WHETHER IN CONTRACT, STRICT LIABILITY, OR TORT (INCLUDING NEGLIGENCE OR OTHERWISE)
+// ARISING IN ANY WAY OUT OF THE USE OF THIS SOFTWARE, EVEN IF ADVISED OF THE
+// POSSIBILITY OF SUCH DAMAGE.
+
+package gotracer
+
+import (
+	"encoding/binary"
+	"errors"
+	"fmt"
+	"math"
+	"reflect"
+	"sort"
+	"strings"
+	"time"
+)
+
+// SchemaVersion is the version of the set of fields in TracerStatus. It is
+// included in the JSON output and increased whenever fields are added, removed
+// or changed. Readings stored before the version was introduced have none and
+// are version 0.
+const SchemaVersion = 4
+
+// ToMap returns the values of the reading keyed by their JSON names, together
+// with the schema version under "v". Values of nested structs, such as
+// BatteryStatus, are keyed by the struct and value names joined by a dot, for
+// example "bstatus.vs". Like in the JSON output the load values are left out
+// when the controller has no load terminal.
+func (t TracerStatus) ToMap() map[string]interface{} {
+	m := map[string]interface{}{"v": SchemaVersion}
+	addFields(m, "", reflect.ValueOf(t))
+	if t.NoLoad {
+		for _, k := range []string{"lv", "lc", "lp", "load"} {
+			delete(m, k)
+		}
+	}
+	return m
+}
+
+// FieldNamer maps the key of a value, its JSON name such as "bv", to the name a
+// downstream system expects.
+type FieldNamer interface {
+	FieldName(key string) string
+}
+
+// FieldMap is a FieldNamer renaming the keys found in the map and leaving other
+// keys as they are.
+type FieldMap map[string]string
+
+// FieldName returns the name of key in the map, or key if it has none.
+func (m FieldMap) FieldName(key string) string {
+	if name, ok := m[key]; ok {
+		return name
+	}
+	return key
+}
+
+// ToMapNamed is like ToMap with the keys renamed by n.
+func (t TracerStatus) ToMapNamed(n FieldNamer) map[string]interface{} {
+	m := t.ToMap()
+	named := make(map[string]interface{}, len(m))
+	for k, v := range m {
+		named[n.FieldName(k)] = v
+	}
+	return named
+}
+
+// Adds the fields of struct v with a JSON name to m.
+func addFields(m map[string]interface{}, prefix string, v reflect.Value) {
+	typ := v.Type()
+	for i := 0; i < typ.NumField(); i++ {
+		f := typ.Field(i)
+		name := strings.Split(f.Tag.Get("json"), ",")[0]
+		if name == "" || name == "-" {
+			continue
+		}
+		if f.Type.Kind() == reflect.Struct && f.Type != reflect.TypeOf(time.Time{}) {
+			addFields(m, prefix+name+".", v.Field(i))
+			continue
+		}
+		if f.Type.Kind() == reflect.Int {
+			// Enumerations such as BatteryVoltageState as plain numbers.
+			m[prefix+name] = int(v.Field(i).Int())
+			continue
+		}
+		m[prefix+name] = v.Field(i).Interface()
+	}
+}
+
+// BinarySize is the length of the binary encoding of a TracerStatus.
+const BinarySize = 49
+
+// binaryVersion is the first byte of the binary encoding, increased whenever
+// the layout changes.
+const binaryVersion = 3
+
+// Lengths of the binary encodings of layout versions 1 and 2, which are still
+// decoded.
+const (
+	binarySizeV1 = 57
+	binarySizeV2 = 61
+)
+
+// ErrBinaryFormat is returned by UnmarshalBinary for data that is not a binary
+// encoded reading of a known layout.
+var ErrBinaryFormat = errors.New("invalid binary status")
+
+// MarshalBinary encodes the reading into BinarySize bytes, for links where JSON
+// is too large. Values are stored as fixed-point integers, big-endian, in the
+// layout below. Values outside the range of their field are clamped and the
+// timestamp is truncated to whole seconds.
+//
+// To keep a reading under 50 bytes ArrayPower and LoadPower are not stored, they
+// are decoded as voltage times current, and the monthly and annual energy
+// counters are stored with lower resolution than the daily and total ones.
+//
+//	offset size type   field                          unit
+//	0      1    uint8  layout version, currently 3
+//	1      1    uint8  flags: bit 0 Load, bit 1 NoLoad, bit 2 ArrayOverVoltage,
+//	                   bits 3-5 LoadState, bit 6 ChargingFaults.Fault
+//	2      1    uint8  BatteryStatus: bits 0-2 VoltageState, bits 3-4 TempState,
+//	                   bit 5 AbnormalResistance, bit 6 WrongRatedVoltage
+//	3      4    uint32 Timestamp                      Unix seconds, 0 if not set
+//	7      2    uint16 ArrayVoltage                   0.01 V
+//	9      2    uint16 ArrayCurrent                   0.01 A
+//	11     2    uint16 BatteryVoltage                 0.01 V
+//	13     2    int16  BatteryCurrent                 0.01 A
+//	15     1    uint8  BatterySOC                     %
+//	16     2    int16  BatteryTemp                    0.01 C
+//	18     2    uint16 BatteryMaxVoltage              0.01 V
+//	20     2    uint16 BatteryMinVoltage              0.01 V
+//	22     2    int16  DeviceTemp                     0.01 C
+//	24     2    int16  HeatsinkTemp                   0.01 C
+//	26     2    uint16 LoadVoltage                    0.01 V
+//	28     2    uint16 LoadCurrent                    0.01 A
+//	30     1    uint8  ChargingFaults: bit 0 ArrayShort, bit 1 LoadMOSFETShort,
+//	                   bit 2 LoadShort, bit 3 LoadOverCurrent, bit 4 InputOverCurrent,
+//	                   bit 5 AntiReverseMOSFETShort, bit 6 ChargingAntiReverseShort,
+//	                   bit 7 ChargingMOSFETShort
+//	31     2    uint16 EnergyConsumedDaily            0.01 kWh
+//	33     2    uint16 EnergyConsumedMonthly          0.1 kWh
+//	35     2    uint16 EnergyConsumedAnnual           1 kWh
+//	37     3    uint24 EnergyConsumedTotal            0.01 kWh
+//	40     2    uint16 EnergyGeneratedDaily           0.01 kWh
+//	42     2    uint16 EnergyGeneratedMonthly         0.1 kWh
+//	44     2    uint16 EnergyGeneratedAnnual          1 kWh
+//	46     3    uint24 EnergyGeneratedTotal           0.01 kWh
+func (t TracerStatus) MarshalBinary() ([]byte, error) {
+	b := make([]byte, BinarySize)
+	b[0] = binaryVersion
+	b[1] = flag(t.Load, 0) | flag(t.NoLoad, 1) | flag(t.ArrayOverVoltage, 2) | byte(t.LoadState)&0x07<<3 | flag(t.ChargingFaults.Fault, 6)
+	b[2] = encodeBinaryBatteryStatus(t.BatteryStatus)
+	if !t.Timestamp.IsZero() {
+		binary.BigEndian.PutUint32(b[3:], uint32(clamp(float64(t.Timestamp.Unix()), 1, 0, math.MaxUint32)))
+	}
+	putUint16(b[7:], t.ArrayVoltage, 100)
+	putUint16(b[9:], t.ArrayCurrent, 100)
+	putUint16(b[11:], t.BatteryVoltage, 100)
+	putInt16(b[13:], t.BatteryCurrent, 100)
+	b[15] = byte(clamp(float64(t.BatterySOC), 1, 0, math.MaxUint8))
+	putInt16(b[16:], t.BatteryTemp, 100)
+	putUint16(b[18:], t.BatteryMaxVoltage, 100)
+	putUint16(b[20:], t.BatteryMinVoltage, 100)
+	putInt16(b[22:], t.DeviceTemp, 100)
+	putInt16(b[24:], t.HeatsinkTemp, 100)
+	putUint16(b[26:], t.LoadVoltage, 100)
+	putUint16(b[28:], t.LoadCurrent, 100)
+	f := t.ChargingFaults
+	for i, set := range binaryFaults(&f) {
+		b[30] |= flag(*set, uint(i))
+	}
+	for i, e := range [][4]float32{
+		{t.EnergyConsumedDaily, t.EnergyConsumedMonthly, t.EnergyConsumedAnnual, t.EnergyConsumedTotal},
+		{t.EnergyGeneratedDaily, t.EnergyGeneratedMonthly, t.EnergyGeneratedAnnual, t.EnergyGeneratedTotal},
+	} {
+		o := 31 + i*9
+		putUint16(b[o:], e[0], 100)
+		putUint16(b[o+2:], e[1], 10)
+		putUint16(b[o+4:], e[2], 1)
+		putUint24(b[o+6:], e[3], 100)
+	}
+	return b, nil
+}
+
+// UnmarshalBinary decodes a reading encoded by MarshalBinary. Readings encoded
+// with layout versions 1 and 2 are also accepted, see unmarshalBinaryV2.
+func (t *TracerStatus) UnmarshalBinary(b []byte) error {
+	switch {
+	case len(b) == BinarySize && b[0] == binaryVersion:
+	case len(b) == binarySizeV1 && b[0] == 1, len(b) == binarySizeV2 && b[0] == 2:
+		*t = unmarshalBinaryV2(b)
+		return nil
+	default:
+		return ErrBinaryFormat
+	}
+	var r TracerStatus
+	r.Load = b[1]&(1<<0) != 0
+	r.NoLoad = b[1]&(1<<1) != 0
+	r.ArrayOverVoltage = b[1]&(1<<2) != 0
+	r.LoadState = LoadState(b[1] >> 3 & 0x07)
+	r.ChargingFaults.Fault = b[1]&(1<<6) != 0
+	r.BatteryStatus = decodeBinaryBatteryStatus(b[2])
+	if sec := binary.BigEndian.Uint32(b[3:]); sec != 0 {
+		r.Timestamp = time.Unix(int64(sec), 0)
+	}
+	r.ArrayVoltage = uint16At(b[7:], 100)
+	r.ArrayCurrent = uint16At(b[9:], 100)
+	r.ArrayPower = r.ArrayVoltage * r.ArrayCurrent
+	r.BatteryVoltage = uint16At(b[11:], 100)
+	r.BatteryCurrent = int16At(b[13:], 100)
+	r.BatterySOC = int32(b[15])
+	r.BatteryTemp = int16At(b[16:], 100)
+	r.BatteryMaxVoltage = uint16At(b[18:], 100)
+	r.BatteryMinVoltage = uint16At(b[20:], 100)
+	r.DeviceTemp = int16At(b[22:], 100)
+	r.HeatsinkTemp = int16At(b[24:], 100)
+	r.LoadVoltage = uint16At(b[26:], 100)
+	r.LoadCurrent = uint16At(b[28:], 100)
+	r.LoadPower = r.LoadVoltage * r.LoadCurrent
+	for i, set := range binaryFaults(&r.ChargingFaults) {
+		*set = b[30]&(1<<uint(i)) != 0
+	}
+	for i, e := range [][4]*float32{
+		{&r.EnergyConsumedDaily, &r.EnergyConsumedMonthly, &r.EnergyConsumedAnnual, &r.EnergyConsumedTotal},
+		{&r.EnergyGeneratedDaily, &r.EnergyGeneratedMonthly, &r.EnergyGeneratedAnnual, &r.EnergyGeneratedTotal},
+	} {
+		o := 31 + i*9
+		*e[0] = uint16At(b[o:], 100)
+		*e[1] = uint16At(b[o+2:], 10)
+		*e[2] = uint16At(b[o+4:], 1)
+		*e[3] = uint24At(b[o+6:], 100)
+	}
+	*t = r
+	return nil
+}
+
+// Decodes layout version 1, ending at offset 57, and version 2 which adds the
+// charging faults and heatsink temperature. Version 1 readings have them zero.
+//
+//	offset size type   field
+//	0      1    uint8  layout version
+//	1      1    uint8  flags: bit 0 Load, bit 1 NoLoad, bit 2 ArrayOverVoltage
+//	2      1    uint8  LoadState
+//	3      1    uint8  BatteryStatus, as in version 3
+//	4      4    uint32 Timestamp
+//	8      2    uint16 ArrayVoltage, ArrayCurrent, ArrayPower (0.1 W), BatteryVoltage
+//	16     2    int16  BatteryCurrent
+//	18     1    uint8  BatterySOC
+//	19     2    int16  BatteryTemp, then uint16 BatteryMaxVoltage and BatteryMinVoltage
+//	25     2    int16  DeviceTemp, then uint16 LoadVoltage, LoadCurrent and LoadPower (0.1 W)
+//	33     3    uint24 the eight energy counters, consumed then generated, daily to total
+//	57     2    uint16 ChargingFaults, bits of the charging equipment status register
+//	59     2    int16  HeatsinkTemp
+func unmarshalBinaryV2(b []byte) TracerStatus {
+	var r TracerStatus
+	r.Load = b[1]&(1<<0) != 0
+	r.NoLoad = b[1]&(1<<1) != 0
+	r.ArrayOverVoltage = b[1]&(1<<2) != 0
+	r.LoadState = LoadState(b[2])
+	r.BatteryStatus = decodeBinaryBatteryStatus(b[3])
+	if sec := binary.BigEndian.Uint32(b[4:]); sec != 0 {
+		r.Timestamp = time.Unix(int64(sec), 0)
+	}
+	r.ArrayVoltage = uint16At(b[8:], 100)
+	r.ArrayCurrent = uint16At(b[10:], 100)
+	r.ArrayPower = uint16At(b[12:], 10)
+	r.BatteryVoltage = uint16At(b[14:], 100)
+	r.BatteryCurrent = int16At(b[16:], 100)
+	r.BatterySOC = int32(b[18])
+	r.BatteryTemp = int16At(b[19:], 100)
+	r.BatteryMaxVoltage = uint16At(b[21:], 100)
+	r.BatteryMinVoltage = uint16At(b[23:], 100)
+	r.DeviceTemp = int16At(b[25:], 100)
+	r.LoadVoltage = uint16At(b[27:], 100)
+	r.LoadCurrent = uint16At(b[29:], 100)
+	r.LoadPower = uint16At(b[31:], 10)
+	for i, e := range []*float32{&r.EnergyConsumedDaily, &r.EnergyConsumedMonthly, &r.EnergyConsumedAnnual, &r.EnergyConsumedTotal, &r.EnergyGeneratedDaily, &r.EnergyGeneratedMonthly, &r.EnergyGeneratedAnnual, &r.EnergyGeneratedTotal} {
+		*e = uint24At(b[33+i*3:], 100)
+	}
+	if b[0] == 2 {
+		r.ChargingFaults = decodeChargingFaults(binary.BigEndian.Uint16(b[57:]))
+		r.HeatsinkTemp = int16At(b[59:], 100)
+	}
+	return r
+}
+
+func encodeBinaryBatteryStatus(s BatteryStatus) byte {
+	return byte(s.VoltageState)&0x07 | byte(s.TempState)&0x03<<3 | flag(s.AbnormalResistance, 5) | flag(s.WrongRatedVoltage, 6)
+}
+
+func decodeBinaryBatteryStatus(b byte) BatteryStatus {
+	return BatteryStatus{
+		VoltageState:       BatteryVoltageState(b & 0x07),
+		TempState:          BatteryTempState(b >> 3 & 0x03),
+		AbnormalResistance: b&(1<<5) != 0,
+		WrongRatedVoltage:  b&(1<<6) != 0,
+	}
+}
+
+// Returns the charging faults other than Fault in the order of their bits in the
+// binary encoding.
+func binaryFaults(f *ChargingFaults) []*bool {
+	return []*bool{&f.ArrayShort, &f.LoadMOSFETShort, &f.LoadShort, &f.LoadOverCurrent, &f.InputOverCurrent, &f.AntiReverseMOSFETShort, &f.ChargingAntiReverseShort, &f.ChargingMOSFETShort}
+}
+
+// Returns a byte with bit n set if on is true.
+func flag(on bool, n uint) byte {
+	if on {
+		return 1 << n
+	}
+	return 0
+}
+
+// Scales v to a fixed-point integer, rounded and limited to [min, max].
+func clamp(v, scale, min, max float64) int64 {
+	return int64(math.Max(min, math.Min(max, math.Round(v*scale))))
+}
+
+func putUint16(b []byte, v float32, scale float64) {
+	binary.BigEndian.PutUint16(b, uint16(clamp(float64(v), scale, 0, math.MaxUint16)))
+}
+
+func putInt16(b []byte, v float32, scale float64) {
+	binary.BigEndian.PutUint16(b, uint16(int16(clamp(float64(v), scale, math.MinInt16, math.MaxInt16))))
+}
+
+func putUint24(b []byte, v float32, scale float64) {
+	u := uint32(clamp(float64(v), scale, 0, 1<<24-1))
+	b[0], b[1], b[2] = byte(u>>16), byte(u>>8), byte(u)
+}
+
+func uint16At(b []byte, scale float32) float32 {
+	return float32(binary.BigEndian.Uint16(b)) / scale
+}
+
+func int16At(b []byte, scale float32) float32 {
+	return float32(int16(binary.BigEndian.Uint16(b))) / scale
+}
+
+func uint24At(b []byte, scale float32) float32 {
+	return float32(uint32(b[0])<<16|uint32(b[1])<<8|uint32(b[2])) / scale
+}
+
+// Graphite returns the reading in the Graphite plaintext protocol, one line per
+// value of ToMap with prefix and the key joined by a dot as path, for example
+// "solar.bv 13.12 1700000000". Booleans are sent as 0 or 1, the timestamp is the
+// Unix time of the reading and the lines are sorted by path.
+func (t TracerStatus) Graphite(prefix string) string {
+	m := t.ToMap()
+	delete(m, "t")
+	delete(m, "v")
+	keys := make([]string, 0, len(m))
+	for k := range m {
+		keys = append(keys, k)
+	}
+	sort.Strings(keys)
+	var b strings.Builder
+	for _, k := range keys {
+		v := m[k]
+		if on, ok := v.(bool); ok {
+			v = 0
+			if on {
+				v = 1
+			}
+		}
+		path := k
+		if prefix != "" {
+			path = prefix + "." + k
+		}
+		fmt.Fprintf(&b, "%s %v %d\n", path, v, t.Timestamp.Unix())
+	}
+	return b.String()
+}
@@ -0,0 +1,164 @@
+// Copyright (c) 2015, Roland Bali (roland.bali@spagettikod.se), Spagettikod
+// All rights reserved.
+//
+// Redistribution and use in source and binary forms, with or without modification,
+// are permitted provided that the following conditions are met:
+//
+// 1. Redistributions of source code must retain the above copyright notice, this
+//    list of conditions and the following disclaimer.
+//
+// 2. Redistributions in binary form must reproduce the above copyright notice, this
+//    list of conditions and the following disclaimer in the documentation and/or
+//    other materials provided with the distribution.
+//
+// 3. Neither the name of the copyright holder nor the names of its contributors may
+//    be used to endorse or promote products derived from this software without
+//    specific prior written permission.
+//
+// THIS SOFTWARE IS PROVIDED BY THE COPYRIGHT HOLDERS AND CONTRIBUTORS "AS IS" AND
+// ANY EXPRESS OR IMPLIED WARRANTIES, INCLUDING, BUT NOT LIMITED TO, THE IMPLIED
+// WARRANTIES OF MERCHANTABILITY AND FITNESS FOR A PARTICULAR PURPOSE ARE DISCLAIMED.
+// IN NO EVENT SHALL THE COPYRIGHT HOLDER OR CONTRIBUTORS BE LIABLE FOR ANY DIRECT,
+// INDIRECT, INCIDENTAL, SPECIAL, EXEMPLARY, OR CONSEQUENTIAL DAMAGES (INCLUDING, BUT
+// NOT LIMITED TO, PROCUREMENT OF SUBSTITUTE GOODS OR SERVICES; LOSS OF USE, DATA, OR
+// PROFITS; OR BUSINESS INTERRUPTION) HOWEVER CAUSED AND ON ANY THEORY OF LIABILITY,
+// WHETHER IN CONTRACT, STRICT LIABILITY, OR TORT (INCLUDING NEGLIGENCE OR OTHERWISE)
+// ARISING IN ANY WAY OUT OF THE USE OF THIS SOFTWARE, EVEN IF ADVISED OF THE
+// POSSIBILITY OF SUCH DAMAGE.
+
+package gotracer
+
+import (
+	"encoding/binary"
+	"reflect"
+	"testing"
+	"time"
+)
+
+// Returns a reading with every field set to a value the binary encoding holds
+// exactly, except the powers which it recomputes.
+func fullStatus() TracerStatus {
+	return TracerStatus{
+		ArrayVoltage:           35.12,
+		ArrayCurrent:           4.25,
+		ArrayPower:             149.3,
+		ArrayOverVoltage:       true,
+		BatteryVoltage:         13.12,
+		BatteryCurrent:         -2.5,
+		BatterySOC:             87,
+		BatteryTemp:            -4.75,
+		BatteryMaxVoltage:      14.4,
+		BatteryMinVoltage:      12.1,
+		DeviceTemp:             31.5,
+		LoadVoltage:            13.1,
+		LoadCurrent:            1.2,
+		LoadPower:              15.7,
+		Load:                   true,
+		NoLoad:                 true,
+		EnergyConsumedDaily:    0.35,
+		EnergyConsumedMonthly:  10.2,
+		EnergyConsumedAnnual:   121,
+		EnergyConsumedTotal:    350.5,
+		EnergyGeneratedDaily:   0.9,
+		EnergyGeneratedMonthly: 25.5,
+		EnergyGeneratedAnnual:  300,
+		EnergyGeneratedTotal:   900.75,
+		Timestamp:              time.Unix(1700000000, 0),
+		BatteryStatus:          BatteryStatus{VoltageState: BatteryUnderVoltage, TempState: BatteryLowTemp, AbnormalResistance: true, WrongRatedVoltage: true},
+		LoadState:              LoadOffProtection,
+		ChargingFaults:         ChargingFaults{true, true, true, true, true, true, true, true, true},
+		HeatsinkTemp:           -12.34,
+	}
+}
+
+func TestBinaryRoundTrip(t *testing.T) {
+	in := fullStatus()
+	v := reflect.ValueOf(in)
+	for i := 0; i < v.NumField(); i++ {
+		if v.Field(i).IsZero() {
+			t.Fatalf("field %s not set, the test does not cover it", v.Type().Field(i).Name)
+		}
+	}
+	in.ArrayPower = in.ArrayVoltage * in.ArrayCurrent
+	in.LoadPower = in.LoadVoltage * in.LoadCurrent
+	b, err := in.MarshalBinary()
+	if err != nil {
+		t.Fatal(err)
+	}
+	if len(b) != BinarySize {
+		t.Fatalf("encoded %d bytes, want %d", len(b), BinarySize)
+	}
+	var out TracerStatus
+	if err := out.UnmarshalBinary(b); err != nil {
+		t.Fatal(err)
+	}
+	if !out.Timestamp.Equal(in.Timestamp) {
+		t.Errorf("timestamp %v, want %v", out.Timestamp, in.Timestamp)
+	}
+	out.Timestamp = in.Timestamp
+	if !reflect.DeepEqual(out, in) {
+		t.Errorf("round trip gave\n%+v\nwant\n%+v", out, in)
+	}
+}
+
+func TestBinarySize(t *testing.T) {
+	if BinarySize >= 50 {
+		t.Errorf("BinarySize is %d bytes, want under 50", BinarySize)
+	}
+}
+
+// Encodes t in layout version 2, the layout of version 1 followed by the
+// charging faults and heatsink temperature.
+func marshalBinaryV2(t TracerStatus) []byte {
+	b := make([]byte, binarySizeV2)
+	b[0] = 2
+	b[1] = flag(t.Load, 0) | flag(t.NoLoad, 1) | flag(t.ArrayOverVoltage, 2)
+	b[2] = byte(t.LoadState)
+	b[3] = encodeBinaryBatteryStatus(t.BatteryStatus)
+	binary.BigEndian.PutUint32(b[4:], uint32(t.Timestamp.Unix()))
+	for i, v := range []struct {
+		v     float32
+		scale float64
+	}{{t.ArrayVoltage, 100}, {t.ArrayCurrent, 100}, {t.ArrayPower, 10}, {t.BatteryVoltage, 100}} {
+		putUint16(b[8+2*i:], v.v, v.scale)
+	}
+	putInt16(b[16:], t.BatteryCurrent, 100)
+	b[18] = byte(t.BatterySOC)
+	putInt16(b[19:], t.BatteryTemp, 100)
+	putUint16(b[21:], t.BatteryMaxVoltage, 100)
+	putUint16(b[23:], t.BatteryMinVoltage, 100)
+	putInt16(b[25:], t.DeviceTemp, 100)
+	putUint16(b[27:], t.LoadVoltage, 100)
+	putUint16(b[29:], t.LoadCurrent, 100)
+	putUint16(b[31:], t.LoadPower, 10)
+	for i, e := range []float32{t.EnergyConsumedDaily, t.EnergyConsumedMonthly, t.EnergyConsumedAnnual, t.EnergyConsumedTotal, t.EnergyGeneratedDaily, t.EnergyGeneratedMonthly, t.EnergyGeneratedAnnual, t.EnergyGeneratedTotal} {
+		putUint24(b[33+3*i:], e, 100)
+	}
+	binary.BigEndian.PutUint16(b[57:], encodeChargingFaults(t.ChargingFaults))
+	putInt16(b[59:], t.HeatsinkTemp, 100)
+	return b
+}
+
+func TestUnmarshalBinaryVersions(t *testing.T) {
+	in := fullStatus()
+	var out TracerStatus
+	if err := out.UnmarshalBinary(marshalBinaryV2(in)); err != nil {
+		t.Fatal(err)
+	}
+	out.Timestamp = in.Timestamp
+	if !reflect.DeepEqual(out, in) {
+		t.Errorf("version 2 decoded as\n%+v\nwant\n%+v", out, in)
+	}
+
+	b := marshalBinaryV2(in)[:binarySizeV1]
+	b[0] = 1
+	if err := out.UnmarshalBinary(b); err != nil {
+		t.Fatal(err)
+	}
+	if out.BatteryVoltage != in.BatteryVoltage || out.EnergyGeneratedTotal != in.EnergyGeneratedTotal || out.ChargingFaults != (ChargingFaults{}) || out.HeatsinkTemp != 0 {
+		t.Errorf("version 1 decoded as %+v", out)
+	}
+	if err := out.UnmarshalBinary(append(b, 0, 0, 0, 0)); err != ErrBinaryFormat {
+		t.Errorf("version 1 of %d bytes gave error %v, want ErrBinaryFormat", len(b)+4, err)
+	}
+}
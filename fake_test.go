@@ -0,0 +1,222 @@
+// Copyright (c) 2015, Roland Bali (roland.bali@spagettikod.se), Spagettikod
+// All rights reserved.
+//
+// Redistribution and use in source and binary forms, with or without modification,
+// are permitted provided that the following conditions are met:
+//
+// 1. Redistributions of source code must retain the above copyright notice, this
+//    list of conditions and the following disclaimer.
+//
+// 2. Redistributions in binary form must reproduce the above copyright notice, this
+//    list of conditions and the following disclaimer in the documentation and/or
+//    other materials provided with the distribution.
+//
+// 3. Neither the name of the copyright holder nor the names of its contributors may
+//    be used to endorse or promote products derived from this software without
+//    specific prior written permission.
+//
+// THIS SOFTWARE IS PROVIDED BY THE COPYRIGHT HOLDERS AND CONTRIBUTORS "AS IS" AND
+// ANY EXPRESS OR IMPLIED WARRANTIES, INCLUDING, BUT NOT LIMITED TO, THE IMPLIED
+// WARRANTIES OF MERCHANTABILITY AND FITNESS FOR A PARTICULAR PURPOSE ARE DISCLAIMED.
+// IN NO EVENT SHALL THE COPYRIGHT HOLDER OR CONTRIBUTORS BE LIABLE FOR ANY DIRECT,
+// INDIRECT, INCIDENTAL, SPECIAL, EXEMPLARY, OR CONSEQUENTIAL DAMAGES (INCLUDING, BUT
+// NOT LIMITED TO, PROCUREMENT OF SUBSTITUTE GOODS OR SERVICES; LOSS OF USE, DATA, OR
+// PROFITS; OR BUSINESS INTERRUPTION) HOWEVER CAUSED AND ON ANY THEORY OF LIABILITY,
+// WHETHER IN CONTRACT, STRICT LIABILITY, OR TORT (INCLUDING NEGLIGENCE OR OTHERWISE)
+// ARISING IN ANY WAY OUT OF THE USE OF THIS SOFTWARE, EVEN IF ADVISED OF THE
+// POSSIBILITY OF SUCH DAMAGE.
+
+package gotracer
+
+import (
+	"errors"
+	"io"
+	"runtime"
+	"sync"
+	"time"
+)
+
+// A Tracer simulated at the Modbus level, answering requests from its register
+// and coil maps. Every request written is kept in requests.
+type fakeTracer struct {
+	mu       sync.Mutex
+	holding  map[uint16]uint16
+	input    map[uint16]uint16
+	coils    map[uint16]bool
+	discrete map[uint16]bool
+	requests [][]byte
+	partial  []byte // Request being written
+	pending  []byte // Response not yet read
+	closed   bool
+
+	// Set when a request is written before the response to the previous one has
+	// been read, meaning the frames of two calls interleaved.
+	interleaved bool
+	// Called with each complete request before it is answered.
+	onRequest func(req []byte)
+	// Called with each complete request and the response to it, returning
+	// the response sent instead, for simulating a misbehaving Tracer.
+	alter func(req, resp []byte) []byte
+}
+
+func newFakeTracer() *fakeTracer {
+	return &fakeTracer{
+		holding:  make(map[uint16]uint16),
+		input:    make(map[uint16]uint16),
+		coils:    make(map[uint16]bool),
+		discrete: make(map[uint16]bool),
+	}
+}
+
+// Returns a Tracer using f as its port.
+func (f *fakeTracer) tracer(opts ...Option) *Tracer {
+	cfg := newConfig(append([]Option{WithConnectTimeout(100 * time.Millisecond), WithReadTimeout(20 * time.Millisecond)}, opts...))
+	return &Tracer{portName: "fake", cfg: cfg, port: f, done: make(chan struct{})}
+}
+
+func (f *fakeTracer) Write(p []byte) (int, error) {
+	f.mu.Lock()
+	defer f.mu.Unlock()
+	if f.closed {
+		return 0, errors.New("fake port closed")
+	}
+	if len(f.partial) == 0 && len(f.pending) > 0 {
+		f.interleaved = true
+	}
+	f.partial = append(f.partial, p...)
+	if n := f.requestLen(); n > 0 && len(f.partial) >= n {
+		req := append([]byte(nil), f.partial[:n]...)
+		f.partial = f.partial[n:]
+		f.requests = append(f.requests, req)
+		if f.onRequest != nil {
+			f.onRequest(req)
+		}
+		resp := f.respond(req)
+		if f.alter != nil {
+			resp = f.alter(req, resp)
+		}
+		f.pending = append(f.pending, resp...)
+	}
+	return len(p), nil
+}
+
+// Returns the length of the request being written, or 0 if not known yet.
+func (f *fakeTracer) requestLen() int {
+	if len(f.partial) < 2 {
+		return 0
+	}
+	if f.partial[1] == funcWriteRegisters {
+		if len(f.partial) < 7 {
+			return 0
+		}
+		return 9 + int(f.partial[6])
+	}
+	return 8
+}
+
+// Returns the response to req.
+func (f *fakeTracer) respond(req []byte) []byte {
+	addr, n := uint16(req[2])<<8|uint16(req[3]), uint16(req[4])<<8|uint16(req[5])
+	resp := []byte{req[0], req[1]}
+	switch req[1] {
+	case funcReadCoils, 0x02:
+		bits := f.coils
+		if req[1] == 0x02 {
+			bits = f.discrete
+		}
+		b := make([]byte, (n+7)/8)
+		for i := uint16(0); i < n; i++ {
+			if bits[addr+i] {
+				b[i/8] |= 1 << (i % 8)
+			}
+		}
+		resp = append(append(resp, byte(len(b))), b...)
+	case funcReadHoldingRegisters, funcReadInputRegisters, 0x43:
+		regs := f.input
+		if req[1] == funcReadHoldingRegisters {
+			regs = f.holding
+		}
+		if req[1] == 0x43 {
+			// The real-time data block is answered with 23 words.
+			n = 23
+		}
+		resp = append(resp, byte(2*n))
+		for i := uint16(0); i < n; i++ {
+			resp = append(resp, byte(regs[addr+i]>>8), byte(regs[addr+i]))
+		}
+	case funcWriteSingleCoil:
+		f.coils[addr] = n == 0xff00
+		return req
+	case funcWriteRegisters:
+		for i := uint16(0); i < n; i++ {
+			f.holding[addr+i] = uint16(req[7+2*i])<<8 | uint16(req[8+2*i])
+		}
+		resp = req[:6:6]
+	}
+	return appendCRC(resp)
+}
+
+// Reads like a serial port, a few bytes at a time and returning io.EOF when
+// there is nothing to read.
+func (f *fakeTracer) Read(p []byte) (int, error) {
+	defer runtime.Gosched()
+	f.mu.Lock()
+	defer f.mu.Unlock()
+	if len(f.pending) == 0 {
+		return 0, io.EOF
+	}
+	if len(p) > 4 {
+		p = p[:4]
+	}
+	n := copy(p, f.pending)
+	f.pending = f.pending[n:]
+	return n, nil
+}
+
+// Discards the response not yet read, like flushing the input of a serial port.
+func (f *fakeTracer) Flush() error {
+	f.mu.Lock()
+	defer f.mu.Unlock()
+	f.pending = nil
+	return nil
+}
+
+func (f *fakeTracer) Close() error {
+	f.mu.Lock()
+	defer f.mu.Unlock()
+	f.closed = true
+	return nil
+}
+
+// Returns the requests written with function code fn.
+func (f *fakeTracer) requestsOf(fn byte) [][]byte {
+	f.mu.Lock()
+	defer f.mu.Unlock()
+	var reqs [][]byte
+	for _, r := range f.requests {
+		if r[1] == fn {
+			reqs = append(reqs, r)
+		}
+	}
+	return reqs
+}
+
+// A write request decoded.
+type writeFrame struct {
+	addr uint16
+	regs []uint16
+}
+
+// Returns the write multiple registers requests written.
+func (f *fakeTracer) writes() []writeFrame {
+	var w []writeFrame
+	for _, r := range f.requestsOf(funcWriteRegisters) {
+		n := int(r[6]) / 2
+		regs := make([]uint16, n)
+		for i := range regs {
+			regs[i] = uint16(r[7+2*i])<<8 | uint16(r[8+2*i])
+		}
+		w = append(w, writeFrame{uint16(r[2])<<8 | uint16(r[3]), regs})
+	}
+	return w
+}
@@ -0,0 +1,82 @@
+// Copyright (c) 2015, Roland Bali (roland.bali@spagettikod.se), Spagettikod
+// All rights reserved.
+//
+// Redistribution and use in source and binary forms, with or without modification,
+// are permitted provided that the following conditions are met:
+//
+// 1. Redistributions of source code must retain the above copyright notice, this
+//    list of conditions and the following disclaimer.
+//
+// 2. Redistributions in binary form must reproduce the above copyright notice, this
+//    list of conditions and the following disclaimer in the documentation and/or
+//    other materials provided with the distribution.
+//
+// 3. Neither the name of the copyright holder nor the names of its contributors may
+//    be used to endorse or promote products derived from this software without
+//    specific prior written permission.
+//
+// THIS SOFTWARE IS PROVIDED BY THE COPYRIGHT HOLDERS AND CONTRIBUTORS "AS IS" AND
+// ANY EXPRESS OR IMPLIED WARRANTIES, INCLUDING, BUT NOT LIMITED TO, THE IMPLIED
+// WARRANTIES OF MERCHANTABILITY AND FITNESS FOR A PARTICULAR PURPOSE ARE DISCLAIMED.
+// IN NO EVENT SHALL THE COPYRIGHT HOLDER OR CONTRIBUTORS BE LIABLE FOR ANY DIRECT,
+// INDIRECT, INCIDENTAL, SPECIAL, EXEMPLARY, OR CONSEQUENTIAL DAMAGES (INCLUDING, BUT
+// NOT LIMITED TO, PROCUREMENT OF SUBSTITUTE GOODS OR SERVICES; LOSS OF USE, DATA, OR
+// PROFITS; OR BUSINESS INTERRUPTION) HOWEVER CAUSED AND ON ANY THEORY OF LIABILITY,
+// WHETHER IN CONTRACT, STRICT LIABILITY, OR TORT (INCLUDING NEGLIGENCE OR OTHERWISE)
+// ARISING IN ANY WAY OUT OF THE USE OF THIS SOFTWARE, EVEN IF ADVISED OF THE
+// POSSIBILITY OF SUCH DAMAGE.
+
+package gotracer
+
+import (
+	"errors"
+	"io"
+)
+
+// ErrFrameSize is returned by FrameReader for a frame size that is not positive
+// or larger than FrameSize.
+var ErrFrameSize = errors.New("invalid frame size")
+
+// FrameSize is the size of the buffer the responses of the status commands are
+// assembled in, each response at its offset, and the size of a frame read by
+// FrameReader. Buffers stored by earlier versions may be shorter since commands
+// have been added at the end.
+func FrameSize() int {
+	return statusBufferSize
+}
+
+// FrameReader decodes readings from a stream of assembled status buffers, such
+// as a capture file, one fixed-size frame at a time.
+type FrameReader struct {
+	r    io.Reader
+	size int
+	opts []Option
+}
+
+// NewFrameReader returns a FrameReader reading frames of size bytes from r. Use
+// FrameSize for frames of this version, larger frames are not accepted. Shorter
+// frames, stored by an earlier version, are padded with zeros, leaving the values
+// read by the commands added since then zero. Options such as WithDecodeHook
+// apply to each reading.
+func NewFrameReader(r io.Reader, size int, opts ...Option) *FrameReader {
+	return &FrameReader{r: r, size: size, opts: opts}
+}
+
+// Next reads and decodes the next frame. It returns io.EOF when there are no
+// more frames, io.ErrUnexpectedEOF if the stream ends within a frame and
+// ErrFrameSize if the frame size is invalid. The frames hold no time so the
+// timestamp of the reading is not set.
+func (f *FrameReader) Next() (TracerStatus, error) {
+	if f.size <= 0 || f.size > statusBufferSize {
+		return TracerStatus{}, ErrFrameSize
+	}
+	buffer := make([]byte, statusBufferSize)
+	if _, err := io.ReadFull(f.r, buffer[:f.size]); err != nil {
+		return TracerStatus{}, err
+	}
+	r, err := decodeRaw(buffer)
+	if err != nil {
+		return TracerStatus{}, err
+	}
+	return newConfig(f.opts).decoded(r.Scaled())
+}
@@ -0,0 +1,58 @@
+// Copyright (c) 2015, Roland Bali (roland.bali@spagettikod.se), Spagettikod
+// All rights reserved.
+//
+// Redistribution and use in source and binary forms, with or without modification,
+// are permitted provided that the following conditions are met:
+//
+// 1. Redistributions of source code must retain the above copyright notice, this
+//    list of conditions and the following disclaimer.
+//
+// 2. Redistributions in binary form must reproduce the above copyright notice, this
+//    list of conditions and the following disclaimer in the documentation and/or
+//    other materials provided with the distribution.
+//
+// 3. Neither the name of the copyright holder nor the names of its contributors may
+//    be used to endorse or promote products derived from this software without
+//    specific prior written permission.
+//
+// THIS SOFTWARE IS PROVIDED BY THE COPYRIGHT HOLDERS AND CONTRIBUTORS "AS IS" AND
+// ANY EXPRESS OR IMPLIED WARRANTIES, INCLUDING, BUT NOT LIMITED TO, THE IMPLIED
+// WARRANTIES OF MERCHANTABILITY AND FITNESS FOR A PARTICULAR PURPOSE ARE DISCLAIMED.
+// IN NO EVENT SHALL THE COPYRIGHT HOLDER OR CONTRIBUTORS BE LIABLE FOR ANY DIRECT,
+// INDIRECT, INCIDENTAL, SPECIAL, EXEMPLARY, OR CONSEQUENTIAL DAMAGES (INCLUDING, BUT
+// NOT LIMITED TO, PROCUREMENT OF SUBSTITUTE GOODS OR SERVICES; LOSS OF USE, DATA, OR
+// PROFITS; OR BUSINESS INTERRUPTION) HOWEVER CAUSED AND ON ANY THEORY OF LIABILITY,
+// WHETHER IN CONTRACT, STRICT LIABILITY, OR TORT (INCLUDING NEGLIGENCE OR OTHERWISE)
+// ARISING IN ANY WAY OUT OF THE USE OF THIS SOFTWARE, EVEN IF ADVISED OF THE
+// POSSIBILITY OF SUCH DAMAGE.
+
+package gotracer
+
+import (
+	"bytes"
+	"io"
+	"testing"
+)
+
+func TestFrameReaderInvalidSize(t *testing.T) {
+	for _, size := range []int{-1, 0, FrameSize() + 1} {
+		f := NewFrameReader(bytes.NewReader(make([]byte, 4*FrameSize())), size)
+		if _, err := f.Next(); err != ErrFrameSize {
+			t.Errorf("size %d gave %v, want ErrFrameSize", size, err)
+		}
+	}
+}
+
+func TestFrameReaderShortFrames(t *testing.T) {
+	// Two frames of the 120 byte layout, the second one cut short.
+	f := NewFrameReader(bytes.NewReader(make([]byte, 120+60)), 120)
+	if _, err := f.Next(); err != nil {
+		t.Fatal(err)
+	}
+	if _, err := f.Next(); err != io.ErrUnexpectedEOF {
+		t.Errorf("cut frame gave %v, want io.ErrUnexpectedEOF", err)
+	}
+	if _, err := f.Next(); err != io.EOF {
+		t.Errorf("end of stream gave %v, want io.EOF", err)
+	}
+}
@@ -34,12 +34,22 @@
 	series of controllers. The EPsolar provided RJ45 to USB cable can be used to connect
 	the Tracer to a computer.
 
+	Package level functions such as Status open and close the serial port on each call.
+	This is simple but slow, and concurrent calls for the same port interleave their
+	frames on the bus. A Tracer, returned by Open, keeps the port open and serializes
+	calls made from several goroutines.
+
 */
 
 package gotracer
 
 import (
+	"encoding/json"
+	"errors"
 	"fmt"
+	"io"
+	"os"
+	"syscall"
 	"time"
 
 	"github.com/tarm/serial"
@@ -50,6 +60,7 @@ type TracerStatus struct {
 	ArrayVoltage           float32   `json:"pvv"`     // Solar panel voltage, (V)
 	ArrayCurrent           float32   `json:"pvc"`     // Solar panel current, (A)
 	ArrayPower             float32   `json:"pvp"`     // Solar panel power, (W)
+	ArrayOverVoltage       bool      `json:"pvov"`    // Solar panel voltage is higher than the controller allows
 	BatteryVoltage         float32   `json:"bv"`      // Battery voltage, (V)
 	BatteryCurrent         float32   `json:"bc"`      // Battery current, (A)
 	BatterySOC             int32     `json:"bsoc"`    // Battery state of charge, (%)
@@ -61,6 +72,7 @@ type TracerStatus struct {
 	LoadCurrent            float32   `json:"lc"`      // Load current, (A)
 	LoadPower              float32   `json:"lp"`      // Load power, (W)
 	Load                   bool      `json:"load"`    // Shows whether load is on or off
+	NoLoad                 bool      `json:"noload"`  // Controller has no load terminal, load values are not set
 	EnergyConsumedDaily    float32   `json:"ecd"`     // Tracer calculated daily consumption, (kWh)
 	EnergyConsumedMonthly  float32   `json:"ecm"`     // Tracer calculated monthly consumption, (kWh)
 	EnergyConsumedAnnual   float32   `json:"eca"`     // Tracer calculated annual consumption, (kWh)
@@ -70,106 +82,526 @@ type TracerStatus struct {
 	EnergyGeneratedAnnual  float32   `json:"ega"`     // Tracer calculated annual power generation, (kWh)
 	EnergyGeneratedTotal   float32   `json:"egt"`     // Tracer calculated total power generation, (kWh)
 	Timestamp              time.Time `json:"t"`
+
+	BatteryStatus  BatteryStatus  `json:"bstatus"` // Battery voltage, temperature and resistance state
+	LoadState      LoadState      `json:"lstate"`  // Whether load is on, or why it is off
+	ChargingFaults ChargingFaults `json:"cfaults"` // Hardware faults of the charging equipment
+	HeatsinkTemp   float32        `json:"hstemp"`  // Temperature of the power components, (C)
 }
 
 // Formatted output showing all status parameters
 func (t TracerStatus) String() string {
-	return fmt.Sprintf("ArrayVoltage: %.2f\nArrayCurrent: %.2f\nArrayPower: %.2f\nBatteryVoltage: %.2f\nBatteryCurrent: %.2f\nBatterySOC: %v%%\nBatteryTemp: %.2f\nBatteryMaxVoltage: %.2f\nBatteryMinVoltage: %.2f\nDeviceTemp: %.2f\nLoadVoltage: %.2f\nLoadCurrent: %.2f\nLoadPower: %.2f\nLoad: %t\nEnergyConsumedDaily: %.2f\nEnergyConsumedMonthly: %.2f\nEnergyConsumedAnnual:%.2f\nEnergyConsumedTotal:%.2f\nEnergyGeneratedDaily: %.2f\nEnergyGeneratedMonthly: %.2f\nEnergyGeneratedAnnual: %.2f\nEnergyGeneratedTotal: %.2f\n", t.ArrayVoltage, t.ArrayCurrent, t.ArrayPower, t.BatteryVoltage, t.BatteryCurrent, t.BatterySOC, t.BatteryTemp, t.BatteryMaxVoltage, t.BatteryMinVoltage, t.DeviceTemp, t.LoadVoltage, t.LoadCurrent, t.LoadPower, t.Load, t.EnergyConsumedDaily, t.EnergyConsumedMonthly, t.EnergyConsumedAnnual, t.EnergyConsumedTotal, t.EnergyGeneratedDaily, t.EnergyGeneratedMonthly, t.EnergyGeneratedAnnual, t.EnergyGeneratedTotal)
+	return fmt.Sprintf("ArrayVoltage: %.2f\nArrayCurrent: %.2f\nArrayPower: %.2f\nArrayOverVoltage: %t\nBatteryVoltage: %.2f\nBatteryCurrent: %.2f\nBatterySOC: %v%%\nBatteryTemp: %.2f\nBatteryMaxVoltage: %.2f\nBatteryMinVoltage: %.2f\nDeviceTemp: %.2f\nLoadVoltage: %.2f\nLoadCurrent: %.2f\nLoadPower: %.2f\nLoad: %t\nEnergyConsumedDaily: %.2f\nEnergyConsumedMonthly: %.2f\nEnergyConsumedAnnual:%.2f\nEnergyConsumedTotal:%.2f\nEnergyGeneratedDaily: %.2f\nEnergyGeneratedMonthly: %.2f\nEnergyGeneratedAnnual: %.2f\nEnergyGeneratedTotal: %.2f\nBatteryStatus: %v\nLoadState: %v\nChargingFaults: %v\nHeatsinkTemp: %.2f\n", t.ArrayVoltage, t.ArrayCurrent, t.ArrayPower, t.ArrayOverVoltage, t.BatteryVoltage, t.BatteryCurrent, t.BatterySOC, t.BatteryTemp, t.BatteryMaxVoltage, t.BatteryMinVoltage, t.DeviceTemp, t.LoadVoltage, t.LoadCurrent, t.LoadPower, t.Load, t.EnergyConsumedDaily, t.EnergyConsumedMonthly, t.EnergyConsumedAnnual, t.EnergyConsumedTotal, t.EnergyGeneratedDaily, t.EnergyGeneratedMonthly, t.EnergyGeneratedAnnual, t.EnergyGeneratedTotal, t.BatteryStatus, t.LoadState, t.ChargingFaults, t.HeatsinkTemp)
+}
+
+// MarshalJSON adds the schema version, under "v", and omits the load values when
+// the controller has no load terminal.
+func (t TracerStatus) MarshalJSON() ([]byte, error) {
+	type status TracerStatus
+	if !t.NoLoad {
+		return json.Marshal(struct {
+			Version int `json:"v"`
+			status
+		}{SchemaVersion, status(t)})
+	}
+	// Nil fields shadowing the load values of status leave them out.
+	return json.Marshal(struct {
+		Version int `json:"v"`
+		status
+		LoadVoltage *float32 `json:"lv,omitempty"`
+		LoadCurrent *float32 `json:"lc,omitempty"`
+		LoadPower   *float32 `json:"lp,omitempty"`
+		Load        *bool    `json:"load,omitempty"`
+	}{Version: SchemaVersion, status: status(t)})
+}
+
+// UnmarshalStatus decodes a reading from JSON produced by json.Marshal, for
+// example to process stored readings again.
+func UnmarshalStatus(data []byte) (t TracerStatus, err error) {
+	err = json.Unmarshal(data, &t)
+	return
 }
 
 type command struct {
 	data    []byte
 	respLen int
 	offset  int
+	live    bool // Response holds live voltages and currents, sampled by WithSampleCount
 }
 
+// Returns the size of a buffer that holds the responses of commands at their
+// offsets.
+func bufferSize(commands []command) int {
+	n := 0
+	for _, c := range commands {
+		if end := c.offset + c.respLen; end > n {
+			n = end
+		}
+	}
+	return n
+}
+
+const (
+	// Default time to wait for the Tracer to start responding to a command.
+	connectTimeout = time.Second * 3
+	// Default time to wait between bytes once the Tracer has started to respond.
+	readTimeout = time.Millisecond * 500
+	// Read timeout on the serial port, the shortest a read can block.
+	pollTimeout = time.Millisecond * 100
+	// Default baud rate of the Tracer.
+	baudRate = 115200
+)
+
+var (
+	// ErrConnectTimeout is returned when the Tracer never starts to respond to a
+	// command, usually because it is disconnected or powered off.
+	ErrConnectTimeout = errors.New("timed out waiting for response from Tracer")
+
+	// ErrReadTimeout is returned when the Tracer started to respond to a command
+	// but stopped before the complete response was received.
+	ErrReadTimeout = errors.New("timed out reading response from Tracer")
+
+	// ErrDeviceDisconnected is returned when the serial device goes away, for
+	// example when a USB adapter is unplugged or resets. Unlike a timeout the
+	// port has to be opened again, possibly after the device reappears.
+	ErrDeviceDisconnected = errors.New("serial device disconnected")
+
+	// ErrNotSupported is returned when the Tracer does not provide the requested
+	// information or function.
+	ErrNotSupported = errors.New("not supported by Tracer")
+)
+
 var (
 	queryStateCommand = []command{{data: []byte{0x01, 0x04, 0x32, 0x00, 0x00, 0x03, 0xbe, 0xb3}, respLen: 11, offset: 0},
 		{data: []byte{0x01, 0x02, 0x20, 0x00, 0x00, 0x01, 0xb2, 0x0a}, respLen: 6, offset: 11},
-		{data: []byte{0x01, 0x43, 0x31, 0x00, 0x00, 0x1b, 0x0a, 0xf2}, respLen: 51, offset: 17},
-		{data: []byte{0x01, 0x04, 0x33, 0x1a, 0x00, 0x03, 0x9e, 0x88}, respLen: 11, offset: 68},
-		{data: []byte{0x01, 0x04, 0x33, 0x02, 0x00, 0x12, 0xde, 0x83}, respLen: 41, offset: 79}}
+		{data: []byte{0x01, 0x43, 0x31, 0x00, 0x00, 0x1b, 0x0a, 0xf2}, respLen: 51, offset: 17, live: true},
+		{data: []byte{0x01, 0x04, 0x33, 0x1a, 0x00, 0x03, 0x9e, 0x88}, respLen: 11, offset: 68, live: true},
+		{data: []byte{0x01, 0x04, 0x33, 0x02, 0x00, 0x12, 0xde, 0x83}, respLen: 41, offset: 79},
+		{data: []byte{0x01, 0x03, 0x90, 0x3d, 0x00, 0x01, 0x38, 0xc6}, respLen: 7, offset: 120},
+		{data: []byte{0x01, 0x04, 0x31, 0x12, 0x00, 0x01, 0x9f, 0x33}, respLen: 7, offset: 127}}
 )
 
 // Status reads information from the Tracer connected on specified portName.
-func Status(portName string) (t TracerStatus, err error) {
-	c := &serial.Config{Name: portName, Baud: 115200, ReadTimeout: time.Second * 3}
+func Status(portName string, opts ...Option) (t TracerStatus, err error) {
+	r, err := StatusRaw(portName, opts...)
+	if err != nil {
+		return
+	}
+	return newConfig(opts).decoded(r.Scaled())
+}
 
-	port, err := serial.OpenPort(c)
+// StatusRaw reads information from the Tracer connected on specified portName
+// without scaling the register values.
+func StatusRaw(portName string, opts ...Option) (r RawStatus, err error) {
+	err = withPort(portName, opts, func(port io.ReadWriter, cfg config) error {
+		r, err = readStatus(port, cfg, queryStateCommand)
+		return err
+	})
+	return
+}
+
+// StatusDetailed reads information from the Tracer connected on specified
+// portName like Status and also returns the register value behind each value,
+// keyed by JSON name as in RawStatus.Values, for telling a scaling problem from
+// a bad read.
+func StatusDetailed(portName string, opts ...Option) (t TracerStatus, raw map[string]uint32, err error) {
+	r, err := StatusRaw(portName, opts...)
 	if err != nil {
 		return
 	}
-	defer port.Close()
+	t, err = newConfig(opts).decoded(r.Scaled())
+	return t, r.Values(), err
+}
 
-	buffer := make([]byte, 120)
-	for _, r := range queryStateCommand {
-		if _, err = port.Write(r.data); err != nil {
-			return
+// FastStatus reads only the live voltages, currents and powers of the array,
+// battery and load together with the temperatures and SOC from the Tracer
+// connected on specified portName. It sends a single command instead of the
+// several Status sends, for sampling the live values often. The battery
+// current, the status registers and the daily extremes and energy counters are
+// not read, so BatteryCurrent, BatteryMaxVoltage, BatteryMinVoltage, Load,
+// ArrayOverVoltage, BatteryStatus, ChargingFaults, HeatsinkTemp and the energy
+// values are left zero and LoadState is LoadUnknown.
+func FastStatus(portName string, opts ...Option) (t TracerStatus, err error) {
+	err = withPort(portName, opts, func(port io.ReadWriter, cfg config) error {
+		t, err = readFastStatus(port, cfg)
+		return err
+	})
+	return
+}
+
+// Sends the command of the real-time data block only.
+func readFastStatus(port io.ReadWriter, cfg config) (TracerStatus, error) {
+	r, err := readStatus(port, cfg, queryStateCommand[2:3])
+	if err != nil {
+		return TracerStatus{}, err
+	}
+	t := r.Scaled()
+	t.Load, t.LoadState = false, LoadUnknown
+	return cfg.decoded(t)
+}
+
+// The commands of MeterStatus, the status registers, the real-time data block
+// and the statistics block.
+var meterCommands = []command{queryStateCommand[0], queryStateCommand[2], queryStateCommand[4]}
+
+// MeterStatus reads the values shown on the main screens of the MT50 remote
+// meter, the array, battery and load values, SOC, battery status and the energy
+// counters, from the Tracer connected on specified portName, sending three
+// commands instead of the several Status sends. The commands the meter itself
+// sends are not documented by EPsolar and are not replicated, these are the
+// commands of Status covering the same values. BatteryCurrent and HeatsinkTemp
+// are left zero and, since the load mode is not read, LoadState is LoadUnknown
+// when the load is off.
+func MeterStatus(portName string, opts ...Option) (t TracerStatus, err error) {
+	err = withPort(portName, opts, func(port io.ReadWriter, cfg config) error {
+		r, err := readStatus(port, cfg, meterCommands)
+		if err != nil {
+			return err
 		}
+		t = r.Scaled()
+		if !t.Load && !t.NoLoad {
+			t.LoadState = LoadUnknown
+		}
+		t, err = cfg.decoded(t)
+		return err
+	})
+	return
+}
+
+// BatteryReading contain the live battery values.
+type BatteryReading struct {
+	Voltage   float32   `json:"bv"`    // Battery voltage, (V)
+	Current   float32   `json:"bc"`    // Battery current, (A)
+	SOC       int32     `json:"bsoc"`  // Battery state of charge, (%)
+	Temp      float32   `json:"btemp"` // Battery temperatur, (C)
+	Timestamp time.Time `json:"t"`
+}
+
+// ReadBattery reads only the battery voltage, current, SOC and temperature from
+// the Tracer connected on specified portName. It sends the two commands that
+// cover the battery registers and is meant for frequent polling of the battery.
+func ReadBattery(portName string, opts ...Option) (b BatteryReading, err error) {
+	err = withPort(portName, opts, func(port io.ReadWriter, cfg config) error {
+		b, err = readBattery(port, cfg)
+		return err
+	})
+	return
+}
+
+// Sends the commands of the real-time data block and the battery current.
+func readBattery(port io.ReadWriter, cfg config) (BatteryReading, error) {
+	r, err := readStatus(port, cfg, queryStateCommand[2:4])
+	if err != nil {
+		return BatteryReading{}, err
+	}
+	t := r.Scaled()
+	return BatteryReading{t.BatteryVoltage, t.BatteryCurrent, t.BatterySOC, t.BatteryTemp, t.Timestamp}, nil
+}
 
-		b := make([]byte, r.respLen)
-		if _, err = port.Read(b); err != nil {
+// EnergyReading contain the energy counters of the Tracer.
+type EnergyReading struct {
+	EnergyConsumedDaily    float32   `json:"ecd"` // Tracer calculated daily consumption, (kWh)
+	EnergyConsumedMonthly  float32   `json:"ecm"` // Tracer calculated monthly consumption, (kWh)
+	EnergyConsumedAnnual   float32   `json:"eca"` // Tracer calculated annual consumption, (kWh)
+	EnergyConsumedTotal    float32   `json:"ect"` // Tracer calculated total consumption, (kWh)
+	EnergyGeneratedDaily   float32   `json:"egd"` // Tracer calculated daily power generation, (kWh)
+	EnergyGeneratedMonthly float32   `json:"egm"` // Tracer calculated monthly power generation, (kWh)
+	EnergyGeneratedAnnual  float32   `json:"ega"` // Tracer calculated annual power generation, (kWh)
+	EnergyGeneratedTotal   float32   `json:"egt"` // Tracer calculated total power generation, (kWh)
+	Timestamp              time.Time `json:"t"`
+}
+
+// EnergyStatus reads only the energy counters from the Tracer connected on
+// specified portName, using the single command that covers them.
+func EnergyStatus(portName string, opts ...Option) (e EnergyReading, err error) {
+	err = withPort(portName, opts, func(port io.ReadWriter, cfg config) error {
+		e, err = readEnergy(port, cfg)
+		return err
+	})
+	return
+}
+
+// Sends the command of the statistics block.
+func readEnergy(port io.ReadWriter, cfg config) (EnergyReading, error) {
+	r, err := readStatus(port, cfg, queryStateCommand[4:5])
+	if err != nil {
+		return EnergyReading{}, err
+	}
+	t := r.Scaled()
+	return EnergyReading{
+		EnergyConsumedDaily:    t.EnergyConsumedDaily,
+		EnergyConsumedMonthly:  t.EnergyConsumedMonthly,
+		EnergyConsumedAnnual:   t.EnergyConsumedAnnual,
+		EnergyConsumedTotal:    t.EnergyConsumedTotal,
+		EnergyGeneratedDaily:   t.EnergyGeneratedDaily,
+		EnergyGeneratedMonthly: t.EnergyGeneratedMonthly,
+		EnergyGeneratedAnnual:  t.EnergyGeneratedAnnual,
+		EnergyGeneratedTotal:   t.EnergyGeneratedTotal,
+		Timestamp:              t.Timestamp,
+	}, nil
+}
+
+// Sends the status commands and decodes their responses. Values of commands
+// not sent are left zero.
+func readStatus(port io.ReadWriter, cfg config, commands []command) (r RawStatus, err error) {
+	buffer := make([]byte, statusBufferSize)
+	if err = query(port, cfg, buffer, commands...); err != nil {
+		return
+	}
+
+	if r, err = decodeRaw(buffer); err != nil {
+		return
+	}
+	if cfg.samples > 1 {
+		if r, err = sampleLive(port, cfg, buffer, r, commands); err != nil {
 			return
 		}
+	}
+	r.Timestamp = time.Now().UTC()
+	if !cfg.profile.HasLoad {
+		r.NoLoad = true
+		r.LoadVoltage, r.LoadCurrent, r.LoadPower = 0, 0, 0
+	}
+	return
+}
+
+// Sends the live commands among commands again until the configured number of
+// samples is made and returns r with the live voltages, currents and powers
+// averaged over the samples.
+func sampleLive(port io.ReadWriter, cfg config, buffer []byte, r RawStatus, commands []command) (RawStatus, error) {
+	var live []command
+	for _, c := range commands {
+		if c.live {
+			live = append(live, c)
+		}
+	}
+	if len(live) == 0 {
+		return r, nil
+	}
 
-		copy(buffer[r.offset:], b)
+	values := func(r RawStatus) []int64 {
+		return []int64{int64(r.ArrayVoltage), int64(r.ArrayCurrent), int64(r.ArrayPower), int64(r.BatteryVoltage),
+			int64(int16(r.BatteryCurrent)), int64(r.LoadVoltage), int64(r.LoadCurrent), int64(r.LoadPower)}
+	}
+	sums := values(r)
+	for i := 1; i < cfg.samples; i++ {
+		if err := query(port, cfg, buffer, live...); err != nil {
+			return r, err
+		}
+		s, err := decodeRaw(buffer)
+		if err != nil {
+			return r, err
+		}
+		for j, v := range values(s) {
+			sums[j] += v
+		}
+	}
+	n := int64(cfg.samples)
+	avg := func(i int) uint16 {
+		return uint16(sums[i] / n)
+	}
+	r.ArrayVoltage, r.ArrayCurrent, r.ArrayPower, r.BatteryVoltage = avg(0), avg(1), avg(2), avg(3)
+	r.BatteryCurrent = uint16(int16(sums[4] / n))
+	r.LoadVoltage, r.LoadCurrent, r.LoadPower = avg(5), avg(6), avg(7)
+	return r, nil
+}
+
+// Number of times a command sequence is restarted after losing track of which
+// response belongs to which command.
+const maxResyncs = 2
+
+// Sends commands and copies their responses into buffer at the offset of each
+// command. A command that fails is retried on its own, as many times as the
+// configured number of retries, keeping the responses already received. If a
+// response belongs to another command, left over from an earlier one that
+// timed out, the input is discarded and the sequence started over.
+func query(port io.ReadWriter, cfg config, buffer []byte, commands ...command) error {
+	for i := 0; ; i++ {
+		err := querySequence(port, cfg, buffer, commands)
+		if err != ErrDesync || i == maxResyncs {
+			return err
+		}
+		cfg.warning(WarningResync, err.Error())
+		discard(port)
 	}
+}
 
-	t.Timestamp = time.Now().UTC()
+// Sends commands once in order, see query.
+func querySequence(port io.ReadWriter, cfg config, buffer []byte, commands []command) error {
+	for _, c := range commands {
+		b, err := send(port, cfg, c)
+		for i := 0; i < cfg.retries && retryable(err); i++ {
+			cfg.warning(WarningRetry, fmt.Sprintf("command % x: %v", c.data[1:4], err))
+			discard(port)
+			b, err = send(port, cfg, c)
+		}
+		if err != nil {
+			return err
+		}
 
-	t.Load = int(buffer[8]) == 1
-	t.ArrayVoltage = unpack(buffer[24:26]) / 100
-	t.ArrayCurrent = unpack(buffer[26:28]) / 100
-	t.ArrayPower = unpack(buffer[28:30]) / 100
-	t.BatteryVoltage = unpack(buffer[32:34]) / 100
-	t.LoadVoltage = unpack(buffer[40:42]) / 100
-	t.LoadCurrent = unpack(buffer[42:44]) / 100
-	t.LoadPower = unpack(buffer[44:46]) / 100
+		// A response not fitting at its offset would be silently truncated.
+		if c.offset+len(b) > len(buffer) {
+			return ErrShortBuffer
+		}
+		copy(buffer[c.offset:], b)
+	}
+	return nil
+}
 
-	// Battery temperature can be negative.
-	bt := unpack(buffer[56:58])
-	if bt > 32768 {
-		bt = bt - 65536
+// Sends a command and reads its response.
+func send(port io.ReadWriter, cfg config, c command) ([]byte, error) {
+	if err := writeRequest(port, cfg, c.data); err != nil {
+		return nil, err
+	}
+	b, err := readResponse(port, cfg, c.respLen)
+	if err != nil {
+		return nil, err
 	}
-	t.BatteryTemp = bt / 100
+	return b, checkEcho(c.data, b)
+}
 
-	// Device temperature can be negative.
-	dt := unpack(buffer[58:60])
-	if dt > 32768 {
-		dt = dt - 65536
+// Reports whether err is caused by a bad or missing response, in which case
+// sending the command again may succeed.
+func retryable(err error) bool {
+	var e *ModbusException
+	if errors.As(err, &e) {
+		return e.Code == 0x06 // Slave device busy
 	}
-	t.DeviceTemp = dt / 100
+	return err == ErrChecksum || err == ErrConnectTimeout || err == ErrReadTimeout
+}
 
-	// Battery current can be negative.
-	bc := unpack(buffer[73:75])
-	if bc > 32768 {
-		bc = bc - 65536
+// Discards unread input, if the port supports it, so a late or partial response
+// is not mistaken for the response to the next command.
+func discard(port io.ReadWriter) {
+	if f, ok := port.(interface{ Flush() error }); ok {
+		f.Flush()
 	}
-	t.BatteryCurrent = bc / 100
+}
 
-	t.BatterySOC = int32(buffer[65])
-	t.BatteryMaxVoltage = unpack(buffer[82:84]) / 100
-	t.BatteryMinVoltage = unpack(buffer[84:86]) / 100
-	t.EnergyConsumedDaily = unpack(buffer[86:88]) / 100
-	t.EnergyConsumedMonthly = unpack(buffer[88:92]) / 100
-	t.EnergyConsumedAnnual = unpack(buffer[92:96]) / 100
-	t.EnergyConsumedTotal = unpack(buffer[96:100]) / 100
-	t.EnergyGeneratedDaily = unpack(buffer[100:104]) / 100
-	t.EnergyGeneratedMonthly = unpack(buffer[104:108]) / 100
-	t.EnergyGeneratedAnnual = unpack(buffer[108:112]) / 100
-	t.EnergyGeneratedTotal = unpack(buffer[112:116]) / 100
+// Opens the serial port the Tracer is connected to. With a rate limiter the
+// port is reserved until it is closed.
+func openPort(portName string, cfg config) (io.ReadWriteCloser, error) {
+	if cfg.limiter == nil {
+		return serialPort(portName, cfg)
+	}
 
-	return
+	release, err := cfg.limiter.acquire(portName)
+	if err != nil {
+		return nil, err
+	}
+	port, err := serialPort(portName, cfg)
+	if err != nil {
+		release()
+		return nil, err
+	}
+	return &limitedPort{port, release}, nil
+}
+
+// Returns an option opening ports with open instead of as serial ports.
+func withPortOpener(open func(portName string) (io.ReadWriteCloser, error)) Option {
+	return func(c *config) {
+		c.open = open
+	}
+}
+
+func serialPort(portName string, cfg config) (io.ReadWriteCloser, error) {
+	if cfg.open != nil {
+		return cfg.open(portName)
+	}
+	c := &serial.Config{Name: portName, Baud: cfg.baud, ReadTimeout: pollTimeout, Parity: serial.ParityNone}
+	switch cfg.parity {
+	case ParityEven:
+		c.Parity = serial.ParityEven
+	case ParityOdd:
+		c.Parity = serial.ParityOdd
+	}
+	port, err := serial.OpenPort(c)
+	if err != nil {
+		return nil, err
+	}
+	return devicePort{port}, nil
+}
+
+// devicePort reports errors caused by the serial device going away as
+// ErrDeviceDisconnected.
+type devicePort struct {
+	*serial.Port
+}
+
+func (p devicePort) Read(b []byte) (int, error) {
+	n, err := p.Port.Read(b)
+	return n, disconnected(err)
+}
+
+func (p devicePort) Write(b []byte) (int, error) {
+	n, err := p.Port.Write(b)
+	return n, disconnected(err)
+}
+
+// Wraps err in ErrDeviceDisconnected if it means the device is gone.
+func disconnected(err error) error {
+	if errors.Is(err, syscall.EIO) || errors.Is(err, syscall.ENODEV) || errors.Is(err, syscall.ENXIO) || errors.Is(err, os.ErrClosed) {
+		return fmt.Errorf("%w: %w", ErrDeviceDisconnected, err)
+	}
+	return err
+}
+
+// Opens the port, calls fn with it and closes the port again.
+func withPort(portName string, opts []Option, fn func(port io.ReadWriter, cfg config) error) error {
+	cfg := newConfig(opts)
+	port, err := openPort(portName, cfg)
+	if err != nil {
+		return err
+	}
+	defer port.Close()
+	if cfg.autoProfile {
+		if cfg.profile, err = detectProfile(port, cfg); err != nil {
+			return err
+		}
+	}
+	return fn(port, cfg)
+}
+
+// Reads a complete response into b. The Tracer is given the configured connect
+// timeout to send the first byte and the read timeout between each of the
+// following bytes. Reading continues until the whole response is received so
+// each command waits for exactly as many bytes as it expects. If started is true
+// the beginning of the response has already been read.
+func read(port io.Reader, b []byte, started bool, cfg config) error {
+	deadline := time.Now().Add(cfg.connectTimeout)
+	if started {
+		deadline = time.Now().Add(cfg.readTimeout)
+	}
+	n := 0
+	for n < len(b) {
+		m, err := port.Read(b[n:])
+		if m > 0 {
+			n += m
+			deadline = time.Now().Add(cfg.readTimeout)
+			continue
+		}
+		// The serial port returns io.EOF when a read times out without data.
+		if err != nil && err != io.EOF {
+			return err
+		}
+		if time.Now().After(deadline) {
+			if n == 0 && !started {
+				return ErrConnectTimeout
+			}
+			return ErrReadTimeout
+		}
+	}
+	return nil
 }
 
-// Converts a slice of bytes to a float. Byte values are shifted according
+// Converts a slice of bytes to an integer. Byte values are shifted according
 // to their locaiton in the slice. First item in the slice is the highest
 // byte and the last one is the lowest.
-func unpack(slice []byte) float32 {
+func unpack(slice []byte) uint32 {
 	var v uint32
 	for i, b := range slice {
 		shift := uint(((len(slice) - 1 - i) * 8))
 		v += uint32(b) << shift
 	}
-	return float32(v)
+	return v
 }
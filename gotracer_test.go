@@ -0,0 +1,211 @@
+// Copyright (c) 2015, Roland Bali (roland.bali@spagettikod.se), Spagettikod
+// All rights reserved.
+//
+// Redistribution and use in source and binary forms, with or without modification,
+// are permitted provided that the following conditions are met:
+//
+// 1. Redistributions of source code must retain the above copyright notice, this
+//    list of conditions and the following disclaimer.
+//
+// 2. Redistributions in binary form must reproduce the above copyright notice, this
+//    list of conditions and the following disclaimer in the documentation and/or
+//    other materials provided with the distribution.
+//
+// 3. Neither the name of the copyright holder nor the names of its contributors may
+//    be used to endorse or promote products derived from this software without
+//    specific prior written permission.
+//
+// THIS SOFTWARE IS PROVIDED BY THE COPYRIGHT HOLDERS AND CONTRIBUTORS "AS IS" AND
+// ANY EXPRESS OR IMPLIED WARRANTIES, INCLUDING, BUT NOT LIMITED TO, THE IMPLIED
+// WARRANTIES OF MERCHANTABILITY AND FITNESS FOR A PARTICULAR PURPOSE ARE DISCLAIMED.
+// IN NO EVENT SHALL THE COPYRIGHT HOLDER OR CONTRIBUTORS BE LIABLE FOR ANY DIRECT,
+// INDIRECT, INCIDENTAL, SPECIAL, EXEMPLARY, OR CONSEQUENTIAL DAMAGES (INCLUDING, BUT
+// NOT LIMITED TO, PROCUREMENT OF SUBSTITUTE GOODS OR SERVICES; LOSS OF USE, DATA, OR
+// PROFITS; OR BUSINESS INTERRUPTION) HOWEVER CAUSED AND ON ANY THEORY OF LIABILITY,
+// WHETHER IN CONTRACT, STRICT LIABILITY, OR TORT (INCLUDING NEGLIGENCE OR OTHERWISE)
+// ARISING IN ANY WAY OUT OF THE USE OF THIS SOFTWARE, EVEN IF ADVISED OF THE
+// POSSIBILITY OF SUCH DAMAGE.
+
+package gotracer
+
+import (
+	"encoding/json"
+	"errors"
+	"io"
+	"os"
+	"reflect"
+	"strings"
+	"syscall"
+	"testing"
+	"time"
+)
+
+func TestJSONRoundTrip(t *testing.T) {
+	normal := fullStatus()
+	normal.NoLoad = false
+	normal.Timestamp = time.Date(2023, 11, 14, 22, 13, 20, 0, time.UTC)
+
+	noLoad := normal
+	noLoad.NoLoad = true
+	noLoad.LoadVoltage, noLoad.LoadCurrent, noLoad.LoadPower, noLoad.Load = 0, 0, 0, false
+
+	for _, in := range []TracerStatus{normal, noLoad} {
+		data, err := json.Marshal(in)
+		if err != nil {
+			t.Fatal(err)
+		}
+		if !strings.Contains(string(data), `"v":`) {
+			t.Errorf("no schema version in %s", data)
+		}
+		if in.NoLoad && strings.Contains(string(data), `"lv"`) {
+			t.Errorf("load values in %s", data)
+		}
+		out, err := UnmarshalStatus(data)
+		if err != nil {
+			t.Fatal(err)
+		}
+		if !reflect.DeepEqual(out, in) {
+			t.Errorf("round trip of NoLoad %t gave\n%+v\nwant\n%+v", in.NoLoad, out, in)
+		}
+	}
+}
+
+// Returns resp as if it answered function code fn, like a response left over
+// from another command.
+func withFunction(resp []byte, fn byte) []byte {
+	return appendCRC(append([]byte{resp[0], fn}, resp[2:len(resp)-2]...))
+}
+
+func TestQueryResync(t *testing.T) {
+	commands := queryStateCommand[:2]
+	tests := []struct {
+		name     string
+		desyncs  int // Number of responses for another command
+		err      error
+		requests int
+		resyncs  int
+	}{
+		{name: "once", desyncs: 1, requests: 4, resyncs: 1},
+		{name: "always", desyncs: -1, err: ErrDesync, requests: 2 * (maxResyncs + 1), resyncs: maxResyncs},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			f := newFakeTracer()
+			f.discrete[0x2000] = true
+			left := tt.desyncs
+			f.alter = func(req, resp []byte) []byte {
+				if req[1] != 0x02 || left == 0 {
+					return resp
+				}
+				left--
+				return withFunction(resp, 0x01)
+			}
+			cfg := f.tracer().cfg
+			resyncs := 0
+			cfg.warn = func(w Warning) {
+				if w.Category == WarningResync {
+					resyncs++
+				}
+			}
+			buffer := make([]byte, statusBufferSize)
+			if err := query(f, cfg, buffer, commands...); err != tt.err {
+				t.Fatalf("got %v, want %v", err, tt.err)
+			}
+			if len(f.requests) != tt.requests || resyncs != tt.resyncs {
+				t.Errorf("sent %d requests with %d resyncs, want %d and %d", len(f.requests), resyncs, tt.requests, tt.resyncs)
+			}
+			if tt.err == nil && buffer[14] != 1 {
+				t.Errorf("discrete input not in buffer, got % x", buffer[11:17])
+			}
+		})
+	}
+}
+
+func TestQuerySequenceRetry(t *testing.T) {
+	commands := queryStateCommand[:3]
+	tests := []struct {
+		name  string
+		fail  func(resp []byte) []byte
+		err   error
+		sends []byte // Function codes of the requests sent, in order
+	}{
+		{name: "retryable", fail: func(resp []byte) []byte {
+			resp[len(resp)-1] ^= 0xff
+			return resp
+		}, sends: []byte{0x04, 0x02, 0x02, 0x43}},
+		{name: "not retryable", fail: func(resp []byte) []byte {
+			return appendCRC([]byte{resp[0], resp[1] | 0x80, 0x02})
+		}, err: &ModbusException{Function: 0x02, Code: 0x02}, sends: []byte{0x04, 0x02}},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			f := newFakeTracer()
+			failed := false
+			f.alter = func(req, resp []byte) []byte {
+				if req[1] != 0x02 || failed {
+					return resp
+				}
+				failed = true
+				return tt.fail(resp)
+			}
+			err := query(f, f.tracer(WithRetries(2)).cfg, make([]byte, statusBufferSize), commands...)
+			if !reflect.DeepEqual(err, tt.err) {
+				t.Fatalf("got %v, want %v", err, tt.err)
+			}
+			var sends []byte
+			for _, r := range f.requests {
+				sends = append(sends, r[1])
+			}
+			if !reflect.DeepEqual(sends, tt.sends) {
+				t.Errorf("sent function codes % x, want % x", sends, tt.sends)
+			}
+		})
+	}
+}
+
+func TestDisconnected(t *testing.T) {
+	tests := []struct {
+		err          error
+		disconnected bool
+	}{
+		{&os.PathError{Op: "read", Path: "/dev/ttyUSB0", Err: syscall.EIO}, true},
+		{&os.PathError{Op: "read", Path: "/dev/ttyUSB0", Err: syscall.ENODEV}, true},
+		{&os.PathError{Op: "write", Path: "/dev/ttyUSB0", Err: syscall.ENXIO}, true},
+		{os.ErrClosed, true},
+		{io.EOF, false},
+	}
+	for _, tt := range tests {
+		err := disconnected(tt.err)
+		if errors.Is(err, ErrDeviceDisconnected) != tt.disconnected {
+			t.Errorf("%v classified as disconnected %t, want %t", tt.err, !tt.disconnected, tt.disconnected)
+		}
+		var pe *os.PathError
+		if !errors.Is(err, tt.err) || errors.As(tt.err, &pe) && !errors.Is(err, pe.Err) {
+			t.Errorf("%v no longer matches the original error", err)
+		}
+	}
+	if disconnected(nil) != nil {
+		t.Error("nil error classified as disconnected")
+	}
+}
+
+func TestSampleCount(t *testing.T) {
+	f := newFakeTracer()
+	n := uint16(0)
+	f.onRequest = func(req []byte) {
+		if req[1] == 0x43 {
+			n++
+			f.input[0x3102] = n * 1000 // Array voltage 10, 20 and 30 V
+		}
+	}
+	s, err := f.tracer(WithSampleCount(3)).Status()
+	if err != nil {
+		t.Fatal(err)
+	}
+	if s.ArrayVoltage != 20 {
+		t.Errorf("array voltage %.2f, want the average 20", s.ArrayVoltage)
+	}
+	if live, once := len(f.requestsOf(0x43)), len(f.requestsOf(0x02)); live != 3 || once != 1 {
+		t.Errorf("live command sent %d times and discrete inputs read %d times, want 3 and 1", live, once)
+	}
+}
@@ -0,0 +1,273 @@
+// Copyright (c) 2015, Roland Bali (roland.bali@spagettikod.se), Spagettikod
+// All rights reserved.
+//
+// Redistribution and use in source and binary forms, with or without modification,
+// are permitted provided that the following conditions are met:
+//
+// 1. Redistributions of source code must retain the above copyright notice, this
+//    list of conditions and the following disclaimer.
+//
+// 2. Redistributions in binary form must reproduce the above copyright notice, this
+//    list of conditions and the following disclaimer in the documentation and/or
+//    other materials provided with the distribution.
+//
+// 3. Neither the name of the copyright holder nor the names of its contributors may
+//    be used to endorse or promote products derived from this software without
+//    specific prior written permission.
+//
+// THIS SOFTWARE IS PROVIDED BY THE COPYRIGHT HOLDERS AND CONTRIBUTORS "AS IS" AND
+// ANY EXPRESS OR IMPLIED WARRANTIES, INCLUDING, BUT NOT LIMITED TO, THE IMPLIED
+// WARRANTIES OF MERCHANTABILITY AND FITNESS FOR A PARTICULAR PURPOSE ARE DISCLAIMED.
+// IN NO EVENT SHALL THE COPYRIGHT HOLDER OR CONTRIBUTORS BE LIABLE FOR ANY DIRECT,
+// INDIRECT, INCIDENTAL, SPECIAL, EXEMPLARY, OR CONSEQUENTIAL DAMAGES (INCLUDING, BUT
+// NOT LIMITED TO, PROCUREMENT OF SUBSTITUTE GOODS OR SERVICES; LOSS OF USE, DATA, OR
+// PROFITS; OR BUSINESS INTERRUPTION) HOWEVER CAUSED AND ON ANY THEORY OF LIABILITY,
+// WHETHER IN CONTRACT, STRICT LIABILITY, OR TORT (INCLUDING NEGLIGENCE OR OTHERWISE)
+// ARISING IN ANY WAY OUT OF THE USE OF THIS SOFTWARE, EVEN IF ADVISED OF THE
+// POSSIBILITY OF SUCH DAMAGE.
+
+package gotracer
+
+import (
+	"errors"
+	"fmt"
+	"io"
+	"strings"
+	"time"
+)
+
+// Load control coils.
+const (
+	coilManualControl = 0x0001 // Load controlled manually (1) or automatically (0)
+	coilLoad          = 0x0002 // Load on (1) or off (0) when controlled manually
+	coilDefaultLoad   = 0x0003 // Load on (1) or off (0) in LoadModeManual
+)
+
+// Load control holding registers.
+const (
+	regLoadMode       = 0x903d // Load control mode
+	regTimerLength    = 0x903e // Length of the first timer period, hours in the high byte and minutes in the low
+	regTimerSelection = 0x9069 // One (0) or two (1) timer periods
+)
+
+// SetLoad turns the load on or off on the Tracer connected on specified portName.
+// The Tracer only honors this when the load is under manual control, see
+// SetManualLoadControl. Under automatic control the write is accepted but the
+// load keeps following the load mode, so a load that does not switch is most
+// often explained by ReadLoadControl reporting Manual as false. In
+// LoadModeManual the load returns to the state set by SetDefaultLoad when
+// manual control is handed back.
+func SetLoad(portName string, on bool, opts ...Option) error {
+	return withPort(portName, opts, func(port io.ReadWriter, cfg config) error {
+		return writeCoil(port, cfg, coilLoad, on)
+	})
+}
+
+// PulseLoad turns the load on the Tracer connected on specified portName on for
+// duration and then off again. Turning the load off is attempted even if turning
+// it on failed, since the load may have been turned on anyway. Like SetLoad it
+// requires the load to be under manual control.
+func PulseLoad(portName string, duration time.Duration, opts ...Option) error {
+	return withPort(portName, opts, func(port io.ReadWriter, cfg config) error {
+		onErr := writeCoil(port, cfg, coilLoad, true)
+		if onErr == nil {
+			time.Sleep(duration)
+		}
+		return errors.Join(onErr, writeCoil(port, cfg, coilLoad, false))
+	})
+}
+
+// ManualLoadControl reports whether the load on the Tracer connected on specified
+// portName is under manual control.
+func ManualLoadControl(portName string, opts ...Option) (enabled bool, err error) {
+	err = withPort(portName, opts, func(port io.ReadWriter, cfg config) error {
+		bits, err := readBits(port, cfg, funcReadCoils, coilManualControl, 1)
+		if err == nil {
+			enabled = bits[0]
+		}
+		return err
+	})
+	return
+}
+
+// SetManualLoadControl takes manual control of the load on the Tracer connected on
+// specified portName, overriding the configured load mode, or hands control back
+// to the controller.
+func SetManualLoadControl(portName string, enabled bool, opts ...Option) error {
+	return withPort(portName, opts, func(port io.ReadWriter, cfg config) error {
+		return writeCoil(port, cfg, coilManualControl, enabled)
+	})
+}
+
+// LoadControl is the state of the load control coils, read together to tell why
+// the load is in its current state.
+type LoadControl struct {
+	Manual    bool `json:"manual"` // Load is under manual control, see SetManualLoadControl
+	On        bool `json:"on"`     // Load is on when under manual control, see SetLoad
+	DefaultOn bool `json:"defon"`  // Load is on in LoadModeManual, see SetDefaultLoad
+}
+
+// ReadLoadControl reads the load control coils from the Tracer connected on
+// specified portName.
+func ReadLoadControl(portName string, opts ...Option) (c LoadControl, err error) {
+	err = withPort(portName, opts, func(port io.ReadWriter, cfg config) error {
+		c, err = readLoadControl(port, cfg)
+		return err
+	})
+	return
+}
+
+func readLoadControl(port io.ReadWriter, cfg config) (LoadControl, error) {
+	bits, err := readBits(port, cfg, funcReadCoils, coilManualControl, coilDefaultLoad-coilManualControl+1)
+	if err != nil {
+		return LoadControl{}, err
+	}
+	return LoadControl{Manual: bits[0], On: bits[coilLoad-coilManualControl], DefaultOn: bits[coilDefaultLoad-coilManualControl]}, nil
+}
+
+// SetDefaultLoad sets whether the load is on or off in LoadModeManual, while
+// the load is not under manual control, on the Tracer connected on specified
+// portName.
+func SetDefaultLoad(portName string, on bool, opts ...Option) error {
+	return withPort(portName, opts, func(port io.ReadWriter, cfg config) error {
+		return writeCoil(port, cfg, coilDefaultLoad, on)
+	})
+}
+
+// LoadMode is how the Tracer controls the load.
+type LoadMode int
+
+// Load modes.
+const (
+	LoadModeManual     LoadMode = iota // Load is only switched manually
+	LoadModeLight                      // Load is on from dusk to dawn
+	LoadModeLightTimer                 // Load is on for set periods after dusk and before dawn
+	LoadModeTime                       // Load is switched at set times of day
+)
+
+func (m LoadMode) String() string {
+	switch m {
+	case LoadModeManual:
+		return "manual"
+	case LoadModeLight:
+		return "light"
+	case LoadModeLightTimer:
+		return "light and timer"
+	case LoadModeTime:
+		return "time"
+	}
+	return "unknown"
+}
+
+// LoadTimer contain the load control mode and the timer periods used in the
+// light and timer mode. The first period starts at dusk, the second one ends at
+// dawn.
+type LoadTimer struct {
+	Mode       LoadMode      `json:"mode"`
+	Period1    time.Duration `json:"p1"`  // Time the load is on from dusk
+	Period2    time.Duration `json:"p2"`  // Time the load is on before dawn
+	TwoPeriods bool          `json:"two"` // Second period is used
+}
+
+// ReadLoadTimer reads the load control mode and timer periods from the Tracer
+// connected on specified portName.
+func ReadLoadTimer(portName string, opts ...Option) (l LoadTimer, err error) {
+	err = withPort(portName, opts, func(port io.ReadWriter, cfg config) error {
+		regs, err := readRegisters(port, cfg, funcReadHoldingRegisters, regLoadMode, 3)
+		if err != nil {
+			return err
+		}
+		l.Mode = LoadMode(regs[0])
+		l.Period1 = hoursMinutes(regs[regTimerLength-regLoadMode])
+		l.Period2 = hoursMinutes(regs[regTimerLength-regLoadMode+1])
+
+		if regs, err = readRegisters(port, cfg, funcReadHoldingRegisters, regTimerSelection, 1); err != nil {
+			return err
+		}
+		l.TwoPeriods = regs[0] == 1
+		return nil
+	})
+	return
+}
+
+// Schedule describes when the load is on, for example "on at dusk for 4h, then
+// off; on 1h before dawn".
+func (l LoadTimer) Schedule() string {
+	switch l.Mode {
+	case LoadModeManual:
+		return "switched manually"
+	case LoadModeLight:
+		return "on from dusk to dawn"
+	case LoadModeLightTimer:
+		periods := []string{fmt.Sprintf("on at dusk for %s, then off", formatHoursMinutes(l.Period1))}
+		if l.TwoPeriods {
+			periods = append(periods, fmt.Sprintf("on %s before dawn", formatHoursMinutes(l.Period2)))
+		}
+		return strings.Join(periods, "; ")
+	case LoadModeTime:
+		return "switched at set times of day"
+	}
+	return "unknown schedule"
+}
+
+// SetLoadMode sets how the Tracer connected on specified portName controls the
+// load.
+func SetLoadMode(portName string, m LoadMode, opts ...Option) error {
+	return withPort(portName, opts, func(port io.ReadWriter, cfg config) error {
+		return writeRegisters(port, cfg, regLoadMode, []uint16{uint16(m)})
+	})
+}
+
+// SetLoadTimer writes the load control mode and timer periods to the Tracer
+// connected on specified portName. Periods are rounded down to whole minutes.
+func SetLoadTimer(portName string, l LoadTimer, opts ...Option) error {
+	return withPort(portName, opts, func(port io.ReadWriter, cfg config) error {
+		return writeLoadTimer(port, cfg, l)
+	})
+}
+
+func writeLoadTimer(port io.ReadWriter, cfg config, l LoadTimer) error {
+	p1, err := encodeHoursMinutes(l.Period1)
+	if err != nil {
+		return err
+	}
+	p2, err := encodeHoursMinutes(l.Period2)
+	if err != nil {
+		return err
+	}
+	if err := writeRegisters(port, cfg, regLoadMode, []uint16{uint16(l.Mode), p1, p2}); err != nil {
+		return err
+	}
+	var two uint16
+	if l.TwoPeriods {
+		two = 1
+	}
+	return writeRegisters(port, cfg, regTimerSelection, []uint16{two})
+}
+
+// Encodes d as a register with hours in the high byte and minutes in the low
+// byte.
+func encodeHoursMinutes(d time.Duration) (uint16, error) {
+	h, m := d/time.Hour, d%time.Hour/time.Minute
+	if d < 0 || h > 0xff {
+		return 0, fmt.Errorf("timer period %v out of range", d)
+	}
+	return uint16(h)<<8 | uint16(m), nil
+}
+
+// Decodes a register with hours in the high byte and minutes in the low byte.
+func hoursMinutes(reg uint16) time.Duration {
+	return time.Duration(reg>>8)*time.Hour + time.Duration(reg&0xff)*time.Minute
+}
+
+// Formats d as hours and minutes, leaving out a part that is zero.
+func formatHoursMinutes(d time.Duration) string {
+	h, m := int(d/time.Hour), int(d%time.Hour/time.Minute)
+	switch {
+	case m == 0:
+		return fmt.Sprintf("%dh", h)
+	case h == 0:
+		return fmt.Sprintf("%dm", m)
+	}
+	return fmt.Sprintf("%dh%dm", h, m)
+}
@@ -0,0 +1,87 @@
+// Copyright (c) 2015, Roland Bali (roland.bali@spagettikod.se), Spagettikod
+// All rights reserved.
+//
+// Redistribution and use in source and binary forms, with or without modification,
+// are permitted provided that the following conditions are met:
+//
+// 1. Redistributions of source code must retain the above copyright notice, this
+//    list of conditions and the following disclaimer.
+//
+// 2. Redistributions in binary form must reproduce the above copyright notice, this
+//    list of conditions and the following disclaimer in the documentation and/or
+//    other materials provided with the distribution.
+//
+// 3. Neither the name of the copyright holder nor the names of its contributors may
+//    be used to endorse or promote products derived from this software without
+//    specific prior written permission.
+//
+// THIS SOFTWARE IS PROVIDED BY THE COPYRIGHT HOLDERS AND CONTRIBUTORS "AS IS" AND
+// ANY EXPRESS OR IMPLIED WARRANTIES, INCLUDING, BUT NOT LIMITED TO, THE IMPLIED
+// WARRANTIES OF MERCHANTABILITY AND FITNESS FOR A PARTICULAR PURPOSE ARE DISCLAIMED.
+// IN NO EVENT SHALL THE COPYRIGHT HOLDER OR CONTRIBUTORS BE LIABLE FOR ANY DIRECT,
+// INDIRECT, INCIDENTAL, SPECIAL, EXEMPLARY, OR CONSEQUENTIAL DAMAGES (INCLUDING, BUT
+// NOT LIMITED TO, PROCUREMENT OF SUBSTITUTE GOODS OR SERVICES; LOSS OF USE, DATA, OR
+// PROFITS; OR BUSINESS INTERRUPTION) HOWEVER CAUSED AND ON ANY THEORY OF LIABILITY,
+// WHETHER IN CONTRACT, STRICT LIABILITY, OR TORT (INCLUDING NEGLIGENCE OR OTHERWISE)
+// ARISING IN ANY WAY OUT OF THE USE OF THIS SOFTWARE, EVEN IF ADVISED OF THE
+// POSSIBILITY OF SUCH DAMAGE.
+
+package gotracer
+
+import (
+	"bytes"
+	"testing"
+	"time"
+)
+
+func TestSetLoadTimerSelectionFrame(t *testing.T) {
+	f := newFakeTracer()
+	tr := f.tracer()
+	if err := tr.SetLoadTimer(LoadTimer{Mode: LoadModeLightTimer, Period1: time.Hour, TwoPeriods: true}); err != nil {
+		t.Fatal(err)
+	}
+	reqs := f.requestsOf(funcWriteRegisters)
+	if len(reqs) != 2 {
+		t.Fatalf("got %d write requests, want 2", len(reqs))
+	}
+	// Write of 1 to the load timing selection register 0x9069.
+	want := []byte{0x01, 0x10, 0x90, 0x69, 0x00, 0x01, 0x02, 0x00, 0x01, 0xfe, 0xa0}
+	if !bytes.Equal(reqs[1], want) {
+		t.Errorf("timer selection request % x, want % x", reqs[1], want)
+	}
+}
+
+func TestSetLoadTimerWrites(t *testing.T) {
+	f := newFakeTracer()
+	tr := f.tracer()
+	l := LoadTimer{Mode: LoadModeLightTimer, Period1: time.Hour + 30*time.Minute, Period2: 45 * time.Minute, TwoPeriods: true}
+	if err := tr.SetLoadTimer(l); err != nil {
+		t.Fatal(err)
+	}
+	want := []writeFrame{
+		{regLoadMode, []uint16{uint16(LoadModeLightTimer), 0x011e, 0x002d}},
+		{0x9069, []uint16{1}},
+	}
+	got := f.writes()
+	if len(got) != len(want) {
+		t.Fatalf("got %d writes, want %d", len(got), len(want))
+	}
+	for i, w := range want {
+		if got[i].addr != w.addr {
+			t.Errorf("write %d to %#04x, want %#04x", i, got[i].addr, w.addr)
+		}
+		if len(got[i].regs) != len(w.regs) {
+			t.Errorf("write %d of %v, want %v", i, got[i].regs, w.regs)
+			continue
+		}
+		for j := range w.regs {
+			if got[i].regs[j] != w.regs[j] {
+				t.Errorf("write %d of %#04x, want %#04x", i, got[i].regs, w.regs)
+				break
+			}
+		}
+	}
+	if f.holding[0x9067] != 0 {
+		t.Errorf("battery rated voltage code overwritten with %d", f.holding[0x9067])
+	}
+}
@@ -0,0 +1,97 @@
+// Copyright (c) 2015, Roland Bali (roland.bali@spagettikod.se), Spagettikod
+// All rights reserved.
+//
+// Redistribution and use in source and binary forms, with or without modification,
+// are permitted provided that the following conditions are met:
+//
+// 1. Redistributions of source code must retain the above copyright notice, this
+//    list of conditions and the following disclaimer.
+//
+// 2. Redistributions in binary form must reproduce the above copyright notice, this
+//    list of conditions and the following disclaimer in the documentation and/or
+//    other materials provided with the distribution.
+//
+// 3. Neither the name of the copyright holder nor the names of its contributors may
+//    be used to endorse or promote products derived from this software without
+//    specific prior written permission.
+//
+// THIS SOFTWARE IS PROVIDED BY THE COPYRIGHT HOLDERS AND CONTRIBUTORS "AS IS" AND
+// ANY EXPRESS OR IMPLIED WARRANTIES, INCLUDING, BUT NOT LIMITED TO, THE IMPLIED
+// WARRANTIES OF MERCHANTABILITY AND FITNESS FOR A PARTICULAR PURPOSE ARE DISCLAIMED.
+// IN NO EVENT SHALL THE COPYRIGHT HOLDER OR CONTRIBUTORS BE LIABLE FOR ANY DIRECT,
+// INDIRECT, INCIDENTAL, SPECIAL, EXEMPLARY, OR CONSEQUENTIAL DAMAGES (INCLUDING, BUT
+// NOT LIMITED TO, PROCUREMENT OF SUBSTITUTE GOODS OR SERVICES; LOSS OF USE, DATA, OR
+// PROFITS; OR BUSINESS INTERRUPTION) HOWEVER CAUSED AND ON ANY THEORY OF LIABILITY,
+// WHETHER IN CONTRACT, STRICT LIABILITY, OR TORT (INCLUDING NEGLIGENCE OR OTHERWISE)
+// ARISING IN ANY WAY OUT OF THE USE OF THIS SOFTWARE, EVEN IF ADVISED OF THE
+// POSSIBILITY OF SUCH DAMAGE.
+
+package gotracer
+
+import "reflect"
+
+// FieldMask selects fields of TracerStatus, one bit for each field.
+type FieldMask uint32
+
+// Field masks, in the order of the fields of TracerStatus.
+const (
+	FieldArrayVoltage FieldMask = 1 << iota
+	FieldArrayCurrent
+	FieldArrayPower
+	FieldArrayOverVoltage
+	FieldBatteryVoltage
+	FieldBatteryCurrent
+	FieldBatterySOC
+	FieldBatteryTemp
+	FieldBatteryMaxVoltage
+	FieldBatteryMinVoltage
+	FieldDeviceTemp
+	FieldLoadVoltage
+	FieldLoadCurrent
+	FieldLoadPower
+	FieldLoad
+	FieldNoLoad
+	FieldEnergyConsumedDaily
+	FieldEnergyConsumedMonthly
+	FieldEnergyConsumedAnnual
+	FieldEnergyConsumedTotal
+	FieldEnergyGeneratedDaily
+	FieldEnergyGeneratedMonthly
+	FieldEnergyGeneratedAnnual
+	FieldEnergyGeneratedTotal
+	FieldTimestamp
+	FieldBatteryStatus
+	FieldLoadState
+	FieldChargingFaults
+	FieldHeatsinkTemp
+)
+
+// Masks of the fields set by the partial reads.
+const (
+	// Fields read by FastStatus.
+	FieldsFastStatus = FieldArrayVoltage | FieldArrayCurrent | FieldArrayPower | FieldBatteryVoltage |
+		FieldBatterySOC | FieldBatteryTemp | FieldDeviceTemp | FieldLoadVoltage | FieldLoadCurrent | FieldLoadPower |
+		FieldNoLoad | FieldTimestamp
+	// Fields of BatteryReading, read by ReadBattery.
+	FieldsBattery = FieldBatteryVoltage | FieldBatteryCurrent | FieldBatterySOC | FieldBatteryTemp | FieldTimestamp
+	// Fields of EnergyReading, read by EnergyStatus.
+	FieldsEnergy = FieldEnergyConsumedDaily | FieldEnergyConsumedMonthly | FieldEnergyConsumedAnnual |
+		FieldEnergyConsumedTotal | FieldEnergyGeneratedDaily | FieldEnergyGeneratedMonthly |
+		FieldEnergyGeneratedAnnual | FieldEnergyGeneratedTotal | FieldTimestamp
+	// All fields.
+	FieldsAll = FieldHeatsinkTemp<<1 - 1
+)
+
+// Merge returns t with the fields selected by mask replaced by those of partial,
+// keeping a complete reading up to date from partial reads, for example
+// t.Merge(fast, FieldsFastStatus) after FastStatus.
+func (t TracerStatus) Merge(partial TracerStatus, mask FieldMask) TracerStatus {
+	dst := reflect.ValueOf(&t).Elem()
+	src := reflect.ValueOf(partial)
+	for i := 0; i < dst.NumField(); i++ {
+		if mask&(1<<uint(i)) != 0 {
+			dst.Field(i).Set(src.Field(i))
+		}
+	}
+	return t
+}
@@ -0,0 +1,415 @@
+// Copyright (c) 2015, Roland Bali (roland.bali@spagettikod.se), Spagettikod
+// All rights reserved.
+//
+// Redistribution and use in source and binary forms, with or without modification,
+// are permitted provided that the following conditions are met:
+//
+// 1. Redistributions of source code must retain the above copyright notice, this
+//    list of conditions and the following disclaimer.
+//
+// 2. Redistributions in binary form must reproduce the above copyright notice, this
+//    list of conditions and the following disclaimer in the documentation and/or
+//    other materials provided with the distribution.
+//
+// 3. Neither the name of the copyright holder nor the names of its contributors may
+//    be used to endorse or promote products derived from this software without
+//    specific prior written permission.
+//
+// THIS SOFTWARE IS PROVIDED BY THE COPYRIGHT HOLDERS AND CONTRIBUTORS "AS IS" AND
+// ANY EXPRESS OR IMPLIED WARRANTIES, INCLUDING, BUT NOT LIMITED TO, THE IMPLIED
+// WARRANTIES OF MERCHANTABILITY AND FITNESS FOR A PARTICULAR PURPOSE ARE DISCLAIMED.
+// IN NO EVENT SHALL THE COPYRIGHT HOLDER OR CONTRIBUTORS BE LIABLE FOR ANY DIRECT,
+// INDIRECT, INCIDENTAL, SPECIAL, EXEMPLARY, OR CONSEQUENTIAL DAMAGES (INCLUDING, BUT
+// NOT LIMITED TO, PROCUREMENT OF SUBSTITUTE GOODS OR SERVICES; LOSS OF USE, DATA, OR
+// PROFITS; OR BUSINESS INTERRUPTION) HOWEVER CAUSED AND ON ANY THEORY OF LIABILITY,
+// WHETHER IN CONTRACT, STRICT LIABILITY, OR TORT (INCLUDING NEGLIGENCE OR OTHERWISE)
+// ARISING IN ANY WAY OUT OF THE USE OF THIS SOFTWARE, EVEN IF ADVISED OF THE
+// POSSIBILITY OF SUCH DAMAGE.
+
+package gotracer
+
+import (
+	"bytes"
+	"errors"
+	"fmt"
+	"io"
+	"strings"
+)
+
+// Modbus device address of the Tracer.
+const deviceID = 0x01
+
+// Modbus function codes.
+const (
+	funcReadCoils            = 0x01
+	funcReadHoldingRegisters = 0x03
+	funcReadInputRegisters   = 0x04
+	funcWriteSingleCoil      = 0x05
+	funcWriteRegisters       = 0x10
+)
+
+// Largest number of registers a single Modbus read request may ask for.
+const maxReadRegisters = 125
+
+// Largest number of registers a single Modbus write request may contain.
+const maxWriteRegisters = 123
+
+// WordOrder is the order of the two 16-bit registers holding a 32-bit value.
+type WordOrder int
+
+// Word orders.
+const (
+	HighWordFirst WordOrder = iota // Most significant word in the first register
+	LowWordFirst                   // Least significant word in the first register
+)
+
+// ErrChecksum is returned when the CRC of a response from the Tracer does not
+// match its content.
+var ErrChecksum = errors.New("invalid checksum in response from Tracer")
+
+// ErrDesync is returned when a response is not for the request just sent, for
+// example the late response to an earlier request.
+var ErrDesync = errors.New("response does not match request")
+
+// WriteMismatchError is returned when the response to a write is not the
+// confirmation expected from the Tracer.
+type WriteMismatchError struct {
+	Expected []byte
+	Received []byte
+}
+
+func (e *WriteMismatchError) Error() string {
+	return fmt.Sprintf("unexpected response to write, expected % x, received % x", e.Expected, e.Received)
+}
+
+// ModbusException is returned when the Tracer responds to a request with a
+// Modbus exception instead of the requested data.
+type ModbusException struct {
+	Function byte // Function code of the request
+	Code     byte // Exception code
+}
+
+func (e *ModbusException) Error() string {
+	return fmt.Sprintf("modbus exception %#02x %s for function %#02x", e.Code, e.meaning(), e.Function)
+}
+
+// Describes the exception code.
+func (e *ModbusException) meaning() string {
+	switch e.Code {
+	case 0x01:
+		return "illegal function"
+	case 0x02:
+		return "illegal data address"
+	case 0x03:
+		return "illegal data value"
+	case 0x04:
+		return "slave device failure"
+	case 0x05:
+		return "acknowledge"
+	case 0x06:
+		return "slave device busy"
+	case 0x08:
+		return "memory parity error"
+	case 0x0a:
+		return "gateway path unavailable"
+	case 0x0b:
+		return "gateway target device failed to respond"
+	}
+	return "unknown exception"
+}
+
+// Calculates the Modbus CRC-16 of b.
+func crc16(b []byte) uint16 {
+	crc := uint16(0xffff)
+	for _, v := range b {
+		crc ^= uint16(v)
+		for i := 0; i < 8; i++ {
+			if crc&1 == 1 {
+				crc = (crc >> 1) ^ 0xa001
+			} else {
+				crc >>= 1
+			}
+		}
+	}
+	return crc
+}
+
+// Appends the CRC of frame to it, low byte first as specified by Modbus.
+func appendCRC(frame []byte) []byte {
+	crc := crc16(frame)
+	return append(frame, byte(crc), byte(crc>>8))
+}
+
+// Reports whether the last two bytes of frame are a valid CRC of the rest.
+func validCRC(frame []byte) bool {
+	if len(frame) < 3 {
+		return false
+	}
+	n := len(frame) - 2
+	crc := crc16(frame[:n])
+	return frame[n] == byte(crc) && frame[n+1] == byte(crc>>8)
+}
+
+// Reads a response of n bytes and validates its CRC. If the Tracer responds with
+// an exception, which is shorter than a normal response, a *ModbusException is
+// returned.
+func readResponse(port io.Reader, cfg config, n int) ([]byte, error) {
+	// Address, function code and first data byte or exception code.
+	b := make([]byte, n)
+	if err := read(port, b[:3], false, cfg); err != nil {
+		return nil, err
+	}
+	if b[1]&0x80 != 0 {
+		b = b[:5]
+	}
+	if err := read(port, b[3:], true, cfg); err != nil {
+		return nil, err
+	}
+	if cfg.observer != nil {
+		cfg.observer(Received, b)
+	}
+	if !validCRC(b) {
+		return nil, ErrChecksum
+	}
+	if b[1]&0x80 != 0 {
+		return nil, &ModbusException{Function: b[1] &^ 0x80, Code: b[2]}
+	}
+	return b, nil
+}
+
+// Direction tells whether a frame was sent to or received from the Tracer.
+type Direction int
+
+// Frame directions.
+const (
+	Sent     Direction = iota // Request sent to the Tracer
+	Received                  // Response received from the Tracer
+)
+
+func (d Direction) String() string {
+	if d == Sent {
+		return "sent"
+	}
+	return "received"
+}
+
+// Writes the request frame req to port. Writing continues until the whole frame
+// is sent since a serial port may write only part of it.
+func writeRequest(port io.Writer, cfg config, req []byte) error {
+	if cfg.observer != nil {
+		cfg.observer(Sent, req)
+	}
+	for len(req) > 0 {
+		n, err := port.Write(req)
+		if err != nil {
+			return err
+		}
+		if n == 0 {
+			return io.ErrShortWrite
+		}
+		req = req[n:]
+	}
+	return nil
+}
+
+// Returns ErrDesync unless the address and function code of response resp are
+// those of request req.
+func checkEcho(req, resp []byte) error {
+	if resp[0] != req[0] || resp[1] != req[1] {
+		return ErrDesync
+	}
+	return nil
+}
+
+// Creates a request for function code fn starting at register addr, the last
+// field is the number of registers or the value depending on function.
+func request(fn byte, addr, value uint16) []byte {
+	return appendCRC([]byte{deviceID, fn, byte(addr >> 8), byte(addr), byte(value >> 8), byte(value)})
+}
+
+// Reads count 16-bit registers starting at addr using function code fn.
+func readRegisters(port io.ReadWriter, cfg config, fn byte, addr, count uint16) ([]uint16, error) {
+	if err := writeRequest(port, cfg, request(fn, addr, count)); err != nil {
+		return nil, err
+	}
+
+	b, err := readResponse(port, cfg, 5+2*int(count))
+	if err != nil {
+		return nil, err
+	}
+	if err := checkEcho([]byte{deviceID, fn}, b); err != nil {
+		return nil, err
+	}
+
+	regs := make([]uint16, count)
+	for i := range regs {
+		regs[i] = uint16(b[3+2*i])<<8 | uint16(b[4+2*i])
+	}
+	return regs, nil
+}
+
+// Reads count coils or discrete inputs, depending on fn, starting at addr.
+func readBits(port io.ReadWriter, cfg config, fn byte, addr, count uint16) ([]bool, error) {
+	if err := writeRequest(port, cfg, request(fn, addr, count)); err != nil {
+		return nil, err
+	}
+
+	b, err := readResponse(port, cfg, 5+(int(count)+7)/8)
+	if err != nil {
+		return nil, err
+	}
+	if err := checkEcho([]byte{deviceID, fn}, b); err != nil {
+		return nil, err
+	}
+
+	bits := make([]bool, count)
+	for i := range bits {
+		bits[i] = b[3+i/8]&(1<<uint(i%8)) != 0
+	}
+	return bits, nil
+}
+
+// Writes the coil at addr. The Tracer confirms the write by echoing the request.
+func writeCoil(port io.ReadWriter, cfg config, addr uint16, on bool) error {
+	var v uint16
+	if on {
+		v = 0xff00
+	}
+	req := request(funcWriteSingleCoil, addr, v)
+	return sendWrite(port, cfg, req, req)
+}
+
+// Writes regs to consecutive holding registers starting at addr. The Tracer
+// confirms the write by echoing the address and number of registers. The write
+// goes through the configured WriteGuard, if there is one.
+func writeRegisters(port io.ReadWriter, cfg config, addr uint16, regs []uint16) error {
+	if len(regs) == 0 || len(regs) > maxWriteRegisters {
+		return fmt.Errorf("cannot write %d registers in one request", len(regs))
+	}
+	head := []byte{deviceID, funcWriteRegisters, byte(addr >> 8), byte(addr), 0, byte(len(regs)), byte(2 * len(regs))}
+	req := head
+	for _, r := range regs {
+		req = append(req, byte(r>>8), byte(r))
+	}
+	write := func() error {
+		return sendWrite(port, cfg, appendCRC(req), appendCRC(head[:6:6]))
+	}
+	if cfg.writeGuard != nil {
+		return cfg.writeGuard.write(port, cfg, addr, regs, write)
+	}
+	return write()
+}
+
+// Sends the write request req. Unless write verification is disabled the response
+// is read and compared to want, the confirmation expected from the Tracer.
+func sendWrite(port io.ReadWriter, cfg config, req, want []byte) error {
+	if err := writeRequest(port, cfg, req); err != nil {
+		return err
+	}
+	if !cfg.verifyWrites {
+		return nil
+	}
+
+	b, err := readResponse(port, cfg, len(want))
+	if err != nil {
+		return err
+	}
+	if !bytes.Equal(b, want) {
+		return &WriteMismatchError{Expected: want, Received: b}
+	}
+	return nil
+}
+
+// DumpRegisters reads count holding registers starting at start from the Tracer
+// connected on specified portName. Large ranges are split into several requests.
+// It is meant for exploring the register map of controllers.
+func DumpRegisters(portName string, start, count uint16, opts ...Option) (regs []uint16, err error) {
+	err = withPort(portName, opts, func(port io.ReadWriter, cfg config) error {
+		regs = make([]uint16, 0, count)
+		for count > 0 {
+			n := count
+			if n > maxReadRegisters {
+				n = maxReadRegisters
+			}
+			r, err := readRegisters(port, cfg, funcReadHoldingRegisters, start, n)
+			if err != nil {
+				return err
+			}
+			regs = append(regs, r...)
+			start += n
+			count -= n
+		}
+		return nil
+	})
+	return
+}
+
+// WriteRegisters writes regs to consecutive holding registers starting at start
+// on the Tracer connected on specified portName, in a single request.
+func WriteRegisters(portName string, start uint16, regs []uint16, opts ...Option) error {
+	return withPort(portName, opts, func(port io.ReadWriter, cfg config) error {
+		return writeRegisters(port, cfg, start, regs)
+	})
+}
+
+// ReadUint32Registers reads count 32-bit values, each held by two holding
+// registers, starting at start from the Tracer connected on specified portName.
+// The order of the registers is set with WithWordOrder.
+func ReadUint32Registers(portName string, start, count uint16, opts ...Option) ([]uint32, error) {
+	regs, err := DumpRegisters(portName, start, 2*count, opts...)
+	if err != nil {
+		return nil, err
+	}
+	order := newConfig(opts).wordOrder
+	values := make([]uint32, count)
+	for i := range values {
+		hi, lo := regs[2*i], regs[2*i+1]
+		if order == LowWordFirst {
+			hi, lo = lo, hi
+		}
+		values[i] = uint32(hi)<<16 | uint32(lo)
+	}
+	return values, nil
+}
+
+// WriteUint32Registers writes values, each to two holding registers, starting at
+// start on the Tracer connected on specified portName. The order of the
+// registers is set with WithWordOrder.
+func WriteUint32Registers(portName string, start uint16, values []uint32, opts ...Option) error {
+	order := newConfig(opts).wordOrder
+	regs := make([]uint16, 0, 2*len(values))
+	for _, v := range values {
+		hi, lo := uint16(v>>16), uint16(v)
+		if order == LowWordFirst {
+			hi, lo = lo, hi
+		}
+		regs = append(regs, hi, lo)
+	}
+	return WriteRegisters(portName, start, regs, opts...)
+}
+
+// ReadString reads count holding registers starting at start from the Tracer
+// connected on specified portName and decodes them as text, two characters in
+// each register. The documented register map of the BN series holds no text, it
+// is meant for controllers and firmware that store, for example, a model name.
+func ReadString(portName string, start, count uint16, opts ...Option) (string, error) {
+	regs, err := DumpRegisters(portName, start, count, opts...)
+	if err != nil {
+		return "", err
+	}
+	return decodeString(regs), nil
+}
+
+// Decodes text packed into registers, the first character in the high byte. The
+// text ends at the first null character and surrounding spaces are removed.
+// Bytes that are not valid UTF-8 are replaced so they do not garble output.
+func decodeString(regs []uint16) string {
+	b := make([]byte, 0, 2*len(regs))
+	for _, r := range regs {
+		b = append(b, byte(r>>8), byte(r))
+	}
+	if i := bytes.IndexByte(b, 0); i >= 0 {
+		b = b[:i]
+	}
+	return strings.TrimSpace(strings.ToValidUTF8(string(b), "\uFFFD"))
+}
@@ -0,0 +1,144 @@
+// Copyright (c) 2015, Roland Bali (roland.bali@spagettikod.se), Spagettikod
+// All rights reserved.
+//
+// Redistribution and use in source and binary forms, with or without modification,
+// are permitted provided that the following conditions are met:
+//
+// 1. Redistributions of source code must retain the above copyright notice, this
+//    list of conditions and the following disclaimer.
+//
+// 2. Redistributions in binary form must reproduce the above copyright notice, this
+//    list of conditions and the following disclaimer in the documentation and/or
+//    other materials provided with the distribution.
+//
+// 3. Neither the name of the copyright holder nor the names of its contributors may
+//    be used to endorse or promote products derived from this software without
+//    specific prior written permission.
+//
+// THIS SOFTWARE IS PROVIDED BY THE COPYRIGHT HOLDERS AND CONTRIBUTORS "AS IS" AND
+// ANY EXPRESS OR IMPLIED WARRANTIES, INCLUDING, BUT NOT LIMITED TO, THE IMPLIED
+// WARRANTIES OF MERCHANTABILITY AND FITNESS FOR A PARTICULAR PURPOSE ARE DISCLAIMED.
+// IN NO EVENT SHALL THE COPYRIGHT HOLDER OR CONTRIBUTORS BE LIABLE FOR ANY DIRECT,
+// INDIRECT, INCIDENTAL, SPECIAL, EXEMPLARY, OR CONSEQUENTIAL DAMAGES (INCLUDING, BUT
+// NOT LIMITED TO, PROCUREMENT OF SUBSTITUTE GOODS OR SERVICES; LOSS OF USE, DATA, OR
+// PROFITS; OR BUSINESS INTERRUPTION) HOWEVER CAUSED AND ON ANY THEORY OF LIABILITY,
+// WHETHER IN CONTRACT, STRICT LIABILITY, OR TORT (INCLUDING NEGLIGENCE OR OTHERWISE)
+// ARISING IN ANY WAY OUT OF THE USE OF THIS SOFTWARE, EVEN IF ADVISED OF THE
+// POSSIBILITY OF SUCH DAMAGE.
+
+package gotracer
+
+import (
+	"bytes"
+	"errors"
+	"io"
+	"reflect"
+	"testing"
+)
+
+func TestReadResponse(t *testing.T) {
+	tests := []struct {
+		name  string
+		alter func(req, resp []byte) []byte
+		want  []uint16
+		err   error
+	}{
+		{name: "valid", want: []uint16{1234, 5678}},
+		{name: "exception", alter: func(req, resp []byte) []byte {
+			return appendCRC([]byte{req[0], req[1] | 0x80, 0x02})
+		}, err: &ModbusException{Function: funcReadHoldingRegisters, Code: 0x02}},
+		{name: "corrupted checksum", alter: func(req, resp []byte) []byte {
+			resp[len(resp)-1] ^= 0xff
+			return resp
+		}, err: ErrChecksum},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			f := newFakeTracer()
+			f.holding[0x9000], f.holding[0x9001] = 1234, 5678
+			f.alter = tt.alter
+			regs, err := readRegisters(f, f.tracer().cfg, funcReadHoldingRegisters, 0x9000, 2)
+			var e *ModbusException
+			switch want := tt.err.(type) {
+			case nil:
+				if err != nil || !reflect.DeepEqual(regs, tt.want) {
+					t.Errorf("got %v, %v, want %v", regs, err, tt.want)
+				}
+			case *ModbusException:
+				if !errors.As(err, &e) || *e != *want {
+					t.Errorf("got %v, want %v", err, want)
+				}
+			default:
+				if err != want {
+					t.Errorf("got %v, want %v", err, want)
+				}
+			}
+		})
+	}
+}
+
+// Accepts at most n bytes on each call to Write.
+type shortWriter struct {
+	n   int
+	buf bytes.Buffer
+}
+
+func (w *shortWriter) Write(p []byte) (int, error) {
+	if len(p) > w.n {
+		p = p[:w.n]
+	}
+	return w.buf.Write(p)
+}
+
+func TestWriteRequest(t *testing.T) {
+	req := request(funcReadHoldingRegisters, 0x9000, 2)
+	w := &shortWriter{n: 1}
+	if err := writeRequest(w, config{}, req); err != nil {
+		t.Fatal(err)
+	}
+	if !bytes.Equal(w.buf.Bytes(), req) {
+		t.Errorf("wrote % x, want % x", w.buf.Bytes(), req)
+	}
+
+	if err := writeRequest(&shortWriter{n: 0}, config{}, req); err != io.ErrShortWrite {
+		t.Errorf("got %v from a port writing nothing, want io.ErrShortWrite", err)
+	}
+}
+
+func TestWriteMismatch(t *testing.T) {
+	tests := []struct {
+		name  string
+		write func(f *fakeTracer) error
+		alter func(resp []byte) []byte
+		want  []byte // Expected confirmation
+	}{
+		{"echoed address", func(f *fakeTracer) error {
+			return writeRegisters(f, f.tracer().cfg, 0x9000, []uint16{1})
+		}, func(resp []byte) []byte {
+			return appendCRC([]byte{resp[0], resp[1], 0x90, 0x01, resp[4], resp[5]})
+		}, appendCRC([]byte{0x01, funcWriteRegisters, 0x90, 0x00, 0x00, 0x01})},
+		{"echoed value", func(f *fakeTracer) error {
+			return writeCoil(f, f.tracer().cfg, coilClearEnergy, true)
+		}, func(resp []byte) []byte {
+			return appendCRC([]byte{resp[0], resp[1], resp[2], resp[3], 0x00, 0x00})
+		}, request(funcWriteSingleCoil, coilClearEnergy, 0xff00)},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			f := newFakeTracer()
+			var echoed []byte
+			f.alter = func(req, resp []byte) []byte {
+				echoed = tt.alter(resp)
+				return echoed
+			}
+			err := tt.write(f)
+			var e *WriteMismatchError
+			if !errors.As(err, &e) {
+				t.Fatalf("got %v, want a *WriteMismatchError", err)
+			}
+			if !bytes.Equal(e.Expected, tt.want) || !bytes.Equal(e.Received, echoed) {
+				t.Errorf("expected % x and received % x, want % x and % x", e.Expected, e.Received, tt.want, echoed)
+			}
+		})
+	}
+}
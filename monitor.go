@@ -0,0 +1,75 @@
+// Copyright (c) 2015, Roland Bali (roland.bali@spagettikod.se), Spagettikod
+// All rights reserved.
+//
+// Redistribution and use in source and binary forms, with or without modification,
+// are permitted provided that the following conditions are met:
+//
+// 1. Redistributions of source code must retain the above copyright notice, this
+//    list of conditions and the following disclaimer.
+//
+// 2. Redistributions in binary form must reproduce the above copyright notice, this
+//    list of conditions and the following disclaimer in the documentation and/or
+//    other materials provided with the distribution.
+//
+// 3. Neither the name of the copyright holder nor the names of its contributors may
+//    be used to endorse or promote products derived from this software without
+//    specific prior written permission.
+//
+// THIS SOFTWARE IS PROVIDED BY THE COPYRIGHT HOLDERS AND CONTRIBUTORS "AS IS" AND
+// ANY EXPRESS OR IMPLIED WARRANTIES, INCLUDING, BUT NOT LIMITED TO, THE IMPLIED
+// WARRANTIES OF MERCHANTABILITY AND FITNESS FOR A PARTICULAR PURPOSE ARE DISCLAIMED.
+// IN NO EVENT SHALL THE COPYRIGHT HOLDER OR CONTRIBUTORS BE LIABLE FOR ANY DIRECT,
+// INDIRECT, INCIDENTAL, SPECIAL, EXEMPLARY, OR CONSEQUENTIAL DAMAGES (INCLUDING, BUT
+// NOT LIMITED TO, PROCUREMENT OF SUBSTITUTE GOODS OR SERVICES; LOSS OF USE, DATA, OR
+// PROFITS; OR BUSINESS INTERRUPTION) HOWEVER CAUSED AND ON ANY THEORY OF LIABILITY,
+// WHETHER IN CONTRACT, STRICT LIABILITY, OR TORT (INCLUDING NEGLIGENCE OR OTHERWISE)
+// ARISING IN ANY WAY OUT OF THE USE OF THIS SOFTWARE, EVEN IF ADVISED OF THE
+// POSSIBILITY OF SUCH DAMAGE.
+
+package gotracer
+
+import (
+	"context"
+	"fmt"
+	"io"
+	"time"
+)
+
+// ANSI escape sequence moving the cursor home and clearing the screen.
+const clearScreen = "\x1b[H\x1b[2J"
+
+// MonitorTo reads the Tracer connected on specified portName every interval and
+// writes its Dashboard to w, clearing the terminal before each, until ctx is
+// done. The port is kept open between readings. A failed reading is written in
+// place of the dashboard and monitoring continues. It returns the error of ctx,
+// or the error if writing to w fails, and ErrInterval if interval is not
+// positive.
+func MonitorTo(ctx context.Context, w io.Writer, portName string, interval time.Duration, opts ...Option) error {
+	if interval <= 0 {
+		return ErrInterval
+	}
+	t, err := Open(portName, opts...)
+	if err != nil {
+		return err
+	}
+	defer t.Close()
+
+	ticker := time.NewTicker(interval)
+	defer ticker.Stop()
+	for {
+		out := clearScreen
+		if s, err := t.Status(); err != nil {
+			out += fmt.Sprintf("Reading Tracer on %s failed: %v\n", portName, err)
+		} else {
+			out += s.Dashboard()
+		}
+		if _, err := io.WriteString(w, out); err != nil {
+			return err
+		}
+		select {
+		case <-ticker.C:
+		case <-ctx.Done():
+			return ctx.Err()
+		}
+	}
+}
@@ -0,0 +1,128 @@
+// Copyright (c) 2015, Roland Bali (roland.bali@spagettikod.se), Spagettikod
+// All rights reserved.
+//
+// Redistribution and use in source and binary forms, with or without modification,
+// are permitted provided that the following conditions are met:
+//
+// 1. Redistributions of source code must retain the above copyright notice, this
+//    list of conditions and the following disclaimer.
+//
+// 2. Redistributions in binary form must reproduce the above copyright notice, this
+//    list of conditions and the following disclaimer in the documentation and/or
+//    other materials provided with the distribution.
+//
+// 3. Neither the name of the copyright holder nor the names of its contributors may
+//    be used to endorse or promote products derived from this software without
+//    specific prior written permission.
+//
+// THIS SOFTWARE IS PROVIDED BY THE COPYRIGHT HOLDERS AND CONTRIBUTORS "AS IS" AND
+// ANY EXPRESS OR IMPLIED WARRANTIES, INCLUDING, BUT NOT LIMITED TO, THE IMPLIED
+// WARRANTIES OF MERCHANTABILITY AND FITNESS FOR A PARTICULAR PURPOSE ARE DISCLAIMED.
+// IN NO EVENT SHALL THE COPYRIGHT HOLDER OR CONTRIBUTORS BE LIABLE FOR ANY DIRECT,
+// INDIRECT, INCIDENTAL, SPECIAL, EXEMPLARY, OR CONSEQUENTIAL DAMAGES (INCLUDING, BUT
+// NOT LIMITED TO, PROCUREMENT OF SUBSTITUTE GOODS OR SERVICES; LOSS OF USE, DATA, OR
+// PROFITS; OR BUSINESS INTERRUPTION) HOWEVER CAUSED AND ON ANY THEORY OF LIABILITY,
+// WHETHER IN CONTRACT, STRICT LIABILITY, OR TORT (INCLUDING NEGLIGENCE OR OTHERWISE)
+// ARISING IN ANY WAY OUT OF THE USE OF THIS SOFTWARE, EVEN IF ADVISED OF THE
+// POSSIBILITY OF SUCH DAMAGE.
+
+package gotracer
+
+import (
+	"errors"
+	"sync"
+	"time"
+)
+
+// Maximum number of ports StatusAll reads at the same time.
+const statusAllWorkers = 4
+
+// ErrTimeout is the error of the ports StatusAll did not finish reading within
+// the time set by WithStatusAllTimeout.
+var ErrTimeout = errors.New("timed out before the port was read")
+
+// WithStatusAllTimeout sets the time StatusAll has to read all ports. Ports not
+// read by then, waiting for a worker or still being read, get ErrTimeout. A port
+// still being read is left to finish in the background. Default is no limit.
+func WithStatusAllTimeout(d time.Duration) Option {
+	return func(c *config) {
+		c.statusAllTime = d
+	}
+}
+
+// TracerStatusResult is the result of reading one port with StatusAll.
+type TracerStatusResult struct {
+	Status TracerStatus
+	Err    error
+}
+
+// StatusAll reads the Tracers connected on each of portNames concurrently, a
+// few ports at a time, and returns the result of each keyed by port name. A port
+// listed more than once is read once. The options, including the timeouts, are
+// shared by all ports, so a Tracer that does not respond holds up one worker for
+// at most the timeouts of a single read while the other ports are read. Use
+// WithStatusAllTimeout to limit the time for reading all of them.
+func StatusAll(portNames []string, opts ...Option) map[string]TracerStatusResult {
+	var unique []string
+	seen := make(map[string]bool, len(portNames))
+	for _, p := range portNames {
+		if !seen[p] {
+			seen[p] = true
+			unique = append(unique, p)
+		}
+	}
+
+	// Closed when the time set by WithStatusAllTimeout is up.
+	expired := make(chan struct{})
+	if d := newConfig(opts).statusAllTime; d > 0 {
+		timer := time.AfterFunc(d, func() { close(expired) })
+		defer timer.Stop()
+	}
+
+	results := make(map[string]TracerStatusResult, len(unique))
+	var mu sync.Mutex
+	late := false // Set when results are no longer added
+	var wg sync.WaitGroup
+	ports := make(chan string)
+	for i := 0; i < statusAllWorkers && i < len(unique); i++ {
+		wg.Add(1)
+		go func() {
+			defer wg.Done()
+			for p := range ports {
+				t, err := Status(p, opts...)
+				mu.Lock()
+				if !late {
+					results[p] = TracerStatusResult{t, err}
+				}
+				mu.Unlock()
+			}
+		}()
+	}
+	finished := make(chan struct{})
+	go func() {
+		defer close(finished)
+		defer wg.Wait()
+		defer close(ports)
+		for _, p := range unique {
+			select {
+			case ports <- p:
+			case <-expired:
+				return
+			}
+		}
+	}()
+	select {
+	case <-finished:
+	case <-expired:
+	}
+
+	mu.Lock()
+	defer mu.Unlock()
+	late = true
+	for _, p := range unique {
+		if _, ok := results[p]; !ok {
+			results[p] = TracerStatusResult{Err: ErrTimeout}
+		}
+	}
+	return results
+}
@@ -0,0 +1,90 @@
+// Copyright (c) 2015, Roland Bali (roland.bali@spagettikod.se), Spagettikod
+// All rights reserved.
+//
+// Redistribution and use in source and binary forms, with or without modification,
+// are permitted provided that the following conditions are met:
+//
+// 1. Redistributions of source code must retain the above copyright notice, this
+//    list of conditions and the following disclaimer.
+//
+// 2. Redistributions in binary form must reproduce the above copyright notice, this
+//    list of conditions and the following disclaimer in the documentation and/or
+//    other materials provided with the distribution.
+//
+// 3. Neither the name of the copyright holder nor the names of its contributors may
+//    be used to endorse or promote products derived from this software without
+//    specific prior written permission.
+//
+// THIS SOFTWARE IS PROVIDED BY THE COPYRIGHT HOLDERS AND CONTRIBUTORS "AS IS" AND
+// ANY EXPRESS OR IMPLIED WARRANTIES, INCLUDING, BUT NOT LIMITED TO, THE IMPLIED
+// WARRANTIES OF MERCHANTABILITY AND FITNESS FOR A PARTICULAR PURPOSE ARE DISCLAIMED.
+// IN NO EVENT SHALL THE COPYRIGHT HOLDER OR CONTRIBUTORS BE LIABLE FOR ANY DIRECT,
+// INDIRECT, INCIDENTAL, SPECIAL, EXEMPLARY, OR CONSEQUENTIAL DAMAGES (INCLUDING, BUT
+// NOT LIMITED TO, PROCUREMENT OF SUBSTITUTE GOODS OR SERVICES; LOSS OF USE, DATA, OR
+// PROFITS; OR BUSINESS INTERRUPTION) HOWEVER CAUSED AND ON ANY THEORY OF LIABILITY,
+// WHETHER IN CONTRACT, STRICT LIABILITY, OR TORT (INCLUDING NEGLIGENCE OR OTHERWISE)
+// ARISING IN ANY WAY OUT OF THE USE OF THIS SOFTWARE, EVEN IF ADVISED OF THE
+// POSSIBILITY OF SUCH DAMAGE.
+
+package gotracer
+
+import (
+	"errors"
+	"io"
+	"sync"
+	"testing"
+	"time"
+)
+
+func TestStatusAll(t *testing.T) {
+	errOpen := errors.New("no such port")
+	var mu sync.Mutex
+	opened := map[string]int{}
+	open := withPortOpener(func(portName string) (io.ReadWriteCloser, error) {
+		mu.Lock()
+		defer mu.Unlock()
+		opened[portName]++
+		if portName == "bad" {
+			return nil, errOpen
+		}
+		f := newFakeTracer()
+		for i := uint16(0); i < 23; i++ {
+			f.input[0x3100+i] = uint16(portName[0]) * 100
+		}
+		return f, nil
+	})
+	results := StatusAll([]string{"a", "b", "a", "bad"}, open, WithConnectTimeout(100*time.Millisecond), WithReadTimeout(20*time.Millisecond))
+	if len(results) != 3 {
+		t.Errorf("got %d results, want 3", len(results))
+	}
+	for _, p := range []string{"a", "b"} {
+		r := results[p]
+		if r.Err != nil || r.Status.BatteryVoltage != float32(p[0]) {
+			t.Errorf("port %s gave %v with battery voltage %.2f, want %d", p, r.Err, r.Status.BatteryVoltage, p[0])
+		}
+		if opened[p] != 1 {
+			t.Errorf("port %s opened %d times, want once", p, opened[p])
+		}
+	}
+	if err := results["bad"].Err; err != errOpen {
+		t.Errorf("port failing to open gave %v, want %v", err, errOpen)
+	}
+}
+
+func TestStatusAllTimeout(t *testing.T) {
+	open := withPortOpener(func(portName string) (io.ReadWriteCloser, error) {
+		time.Sleep(200 * time.Millisecond)
+		return nil, errors.New("too late")
+	})
+	ports := []string{"a", "b", "c", "d", "e", "f"}
+	start := time.Now()
+	results := StatusAll(ports, open, WithStatusAllTimeout(30*time.Millisecond))
+	if d := time.Since(start); d > 150*time.Millisecond {
+		t.Errorf("returned after %v, want about 30ms", d)
+	}
+	for _, p := range ports {
+		if err := results[p].Err; err != ErrTimeout {
+			t.Errorf("port %s gave %v, want ErrTimeout", p, err)
+		}
+	}
+}
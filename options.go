@@ -0,0 +1,214 @@
+// Copyright (c) 2015, Roland Bali (roland.bali@spagettikod.se), Spagettikod
+// All rights reserved.
+//
+// Redistribution and use in source and binary forms, with or without modification,
+// are permitted provided that the following conditions are met:
+//
+// 1. Redistributions of source code must retain the above copyright notice, this
+//    list of conditions and the following disclaimer.
+//
+// 2. Redistributions in binary form must reproduce the above copyright notice, this
+//    list of conditions and the following disclaimer in the documentation and/or
+//    other materials provided with the distribution.
+//
+// 3. Neither the name of the copyright holder nor the names of its contributors may
+//    be used to endorse or promote products derived from this software without
+//    specific prior written permission.
+//
+// THIS SOFTWARE IS PROVIDED BY THE COPYRIGHT HOLDERS AND CONTRIBUTORS "AS IS" AND
+// ANY EXPRESS OR IMPLIED WARRANTIES, INCLUDING, BUT NOT LIMITED TO, THE IMPLIED
+// WARRANTIES OF MERCHANTABILITY AND FITNESS FOR A PARTICULAR PURPOSE ARE DISCLAIMED.
+// IN NO EVENT SHALL THE COPYRIGHT HOLDER OR CONTRIBUTORS BE LIABLE FOR ANY DIRECT,
+// INDIRECT, INCIDENTAL, SPECIAL, EXEMPLARY, OR CONSEQUENTIAL DAMAGES (INCLUDING, BUT
+// NOT LIMITED TO, PROCUREMENT OF SUBSTITUTE GOODS OR SERVICES; LOSS OF USE, DATA, OR
+// PROFITS; OR BUSINESS INTERRUPTION) HOWEVER CAUSED AND ON ANY THEORY OF LIABILITY,
+// WHETHER IN CONTRACT, STRICT LIABILITY, OR TORT (INCLUDING NEGLIGENCE OR OTHERWISE)
+// ARISING IN ANY WAY OUT OF THE USE OF THIS SOFTWARE, EVEN IF ADVISED OF THE
+// POSSIBILITY OF SUCH DAMAGE.
+
+package gotracer
+
+import (
+	"fmt"
+	"io"
+	"time"
+)
+
+// Option configures how to communicate with the Tracer. Options are passed to
+// functions such as Status.
+type Option func(*config)
+
+type config struct {
+	connectTimeout time.Duration
+	readTimeout    time.Duration
+	profile        Profile
+	verifyWrites   bool
+	limiter        *RateLimiter
+	retries        int
+	wordOrder      WordOrder
+	baud           int
+	warn           func(Warning)
+	samples        int
+	observer       func(dir Direction, frame []byte)
+	watchBuffer    int
+	watchPolicy    BufferPolicy
+	decodeHook     func(*TracerStatus)
+	parity         Parity
+	powerTolerance float32
+	autoProfile    bool
+	writeGuard     *WriteGuard
+	onNewDay       func(prev, cur TracerStatus)
+	statusAllTime  time.Duration
+	checkOn        bool
+	checkTolerance float32
+	open           func(portName string) (io.ReadWriteCloser, error)
+}
+
+func newConfig(opts []Option) config {
+	c := config{connectTimeout: connectTimeout, readTimeout: readTimeout, profile: ProfileBN, verifyWrites: true, baud: baudRate}
+	for _, o := range opts {
+		o(&c)
+	}
+	return c
+}
+
+// WithConnectTimeout sets how long to wait for the Tracer to start responding
+// to a command before returning ErrConnectTimeout. Default is 3 seconds.
+func WithConnectTimeout(d time.Duration) Option {
+	return func(c *config) {
+		c.connectTimeout = d
+	}
+}
+
+// WithReadTimeout sets the inter-character timeout, how long to wait for the next
+// byte once the Tracer has started responding before returning ErrReadTimeout.
+// Default is 500 milliseconds.
+func WithReadTimeout(d time.Duration) Option {
+	return func(c *config) {
+		c.readTimeout = d
+	}
+}
+
+// WithBaudRate sets the baud rate of the serial port. Default is 115200, the
+// rate of the Tracer unless it has been changed. ProbeBaud finds the rate of a
+// Tracer.
+func WithBaudRate(baud int) Option {
+	return func(c *config) {
+		c.baud = baud
+	}
+}
+
+// Parity is the parity used on the serial port.
+type Parity int
+
+// Parities.
+const (
+	ParityNone Parity = iota
+	ParityEven
+	ParityOdd
+)
+
+// WithParity sets the parity of the serial port. Default is ParityNone, which the
+// Tracer uses, but some RS-485 gateways expect even parity.
+func WithParity(p Parity) Option {
+	return func(c *config) {
+		c.parity = p
+	}
+}
+
+// WithWriteVerification sets whether writes wait for and verify the confirmation
+// from the Tracer, which is the default. Turning it off makes writes faster but
+// a failed write goes unnoticed.
+func WithWriteVerification(verify bool) Option {
+	return func(c *config) {
+		c.verifyWrites = verify
+	}
+}
+
+// WithRateLimiter serializes and paces access to the port using l.
+func WithRateLimiter(l *RateLimiter) Option {
+	return func(c *config) {
+		c.limiter = l
+	}
+}
+
+// WithRetries sets how many times a command is sent again when its response is
+// missing, incomplete or has an invalid checksum. Only the failing command is
+// sent again, responses already received are kept. Default is no retries.
+func WithRetries(n int) Option {
+	return func(c *config) {
+		c.retries = n
+	}
+}
+
+// WithWordOrder sets the order of the two registers holding a 32-bit value for
+// ReadUint32Registers and WriteUint32Registers. Default is HighWordFirst.
+func WithWordOrder(o WordOrder) Option {
+	return func(c *config) {
+		c.wordOrder = o
+	}
+}
+
+// WithSampleCount sets how many times the commands returning the live voltages,
+// currents and powers are sent for each status reading. The values are averaged
+// over the samples to reduce noise while temperatures, SOC, status and energy
+// counters are read once. Default is a single sample.
+func WithSampleCount(n int) Option {
+	return func(c *config) {
+		c.samples = n
+	}
+}
+
+// WithFrameObserver sets fn to be called with each request frame before it is
+// sent and each complete response frame when it has been received, whether its
+// checksum is valid or not. It is meant for debugging and exploring the
+// protocol, fn must not modify or keep frame.
+func WithFrameObserver(fn func(dir Direction, frame []byte)) Option {
+	return func(c *config) {
+		c.observer = fn
+	}
+}
+
+// WithDecodeHook sets fn to be called with each reading made by Status and
+// FastStatus after it is decoded, before it is returned. The hook may change the
+// reading, for example to correct a known offset of a value.
+func WithDecodeHook(fn func(*TracerStatus)) Option {
+	return func(c *config) {
+		c.decodeHook = fn
+	}
+}
+
+// WithPowerRecompute makes Status replace the array and load power with voltage
+// times current when the reported power differs from it by more than tolerance,
+// a fraction such as 0.1 for 10%, like CheckConsistency. Each replacement is
+// reported as a warning by Watch.
+func WithPowerRecompute(tolerance float32) Option {
+	return func(c *config) {
+		c.powerTolerance = tolerance
+	}
+}
+
+// Returns t with power recomputed, if configured, and passed through the decode
+// hook, if there is one. With WithConsistencyCheck an inconsistent reading fails
+// with ErrInconsistent before anything is recomputed.
+func (c config) decoded(t TracerStatus) (TracerStatus, error) {
+	if c.checkOn {
+		if err := t.CheckConsistency(c.checkTolerance); err != nil {
+			return TracerStatus{}, fmt.Errorf("%w: %w", ErrInconsistent, err)
+		}
+	}
+	if c.powerTolerance > 0 {
+		if powerMismatch(t.ArrayVoltage, t.ArrayCurrent, t.ArrayPower, c.powerTolerance) {
+			c.warning(WarningRecomputed, fmt.Sprintf("array power %.2f recomputed from %.2f V and %.2f A", t.ArrayPower, t.ArrayVoltage, t.ArrayCurrent))
+			t.ArrayPower = t.ArrayVoltage * t.ArrayCurrent
+		}
+		if !t.NoLoad && powerMismatch(t.LoadVoltage, t.LoadCurrent, t.LoadPower, c.powerTolerance) {
+			c.warning(WarningRecomputed, fmt.Sprintf("load power %.2f recomputed from %.2f V and %.2f A", t.LoadPower, t.LoadVoltage, t.LoadCurrent))
+			t.LoadPower = t.LoadVoltage * t.LoadCurrent
+		}
+	}
+	if c.decodeHook != nil {
+		c.decodeHook(&t)
+	}
+	return t, nil
+}
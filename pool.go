@@ -0,0 +1,209 @@
+// Copyright (c) 2015, Roland Bali (roland.bali@spagettikod.se), Spagettikod
+// All rights reserved.
+//
+// Redistribution and use in source and binary forms, with or without modification,
+// are permitted provided that the following conditions are met:
+//
+// 1. Redistributions of source code must retain the above copyright notice, this
+//    list of conditions and the following disclaimer.
+//
+// 2. Redistributions in binary form must reproduce the above copyright notice, this
+//    list of conditions and the following disclaimer in the documentation and/or
+//    other materials provided with the distribution.
+//
+// 3. Neither the name of the copyright holder nor the names of its contributors may
+//    be used to endorse or promote products derived from this software without
+//    specific prior written permission.
+//
+// THIS SOFTWARE IS PROVIDED BY THE COPYRIGHT HOLDERS AND CONTRIBUTORS "AS IS" AND
+// ANY EXPRESS OR IMPLIED WARRANTIES, INCLUDING, BUT NOT LIMITED TO, THE IMPLIED
+// WARRANTIES OF MERCHANTABILITY AND FITNESS FOR A PARTICULAR PURPOSE ARE DISCLAIMED.
+// IN NO EVENT SHALL THE COPYRIGHT HOLDER OR CONTRIBUTORS BE LIABLE FOR ANY DIRECT,
+// INDIRECT, INCIDENTAL, SPECIAL, EXEMPLARY, OR CONSEQUENTIAL DAMAGES (INCLUDING, BUT
+// NOT LIMITED TO, PROCUREMENT OF SUBSTITUTE GOODS OR SERVICES; LOSS OF USE, DATA, OR
+// PROFITS; OR BUSINESS INTERRUPTION) HOWEVER CAUSED AND ON ANY THEORY OF LIABILITY,
+// WHETHER IN CONTRACT, STRICT LIABILITY, OR TORT (INCLUDING NEGLIGENCE OR OTHERWISE)
+// ARISING IN ANY WAY OUT OF THE USE OF THIS SOFTWARE, EVEN IF ADVISED OF THE
+// POSSIBILITY OF SUCH DAMAGE.
+
+package gotracer
+
+import (
+	"errors"
+	"sync"
+	"time"
+)
+
+// ErrPoolClosed is returned by Get when the Pool has been closed.
+var ErrPoolClosed = errors.New("pool is closed")
+
+// Pool keeps Tracer connections open for reuse, keyed by port name. There is at
+// most one connection per port, callers using the same port at the same time
+// share it, which is safe since a Tracer serializes its calls. A connection not
+// used by anyone is closed after IdleTimeout.
+//
+// The zero value is ready to use. Fields must not be changed after first use.
+type Pool struct {
+	// IdleTimeout is how long an unused connection is kept open, zero keeps
+	// it open until the Pool is closed.
+	IdleTimeout time.Duration
+
+	// HealthCheck, if set, is called before an unused connection is handed
+	// out again. If it returns an error the connection is closed and a new
+	// one is opened.
+	HealthCheck func(*Tracer) error
+
+	// Options are used when opening connections.
+	Options []Option
+
+	mu     sync.Mutex
+	conns  map[string]*pooledTracer
+	closed bool
+}
+
+type pooledTracer struct {
+	tracer *Tracer
+	users  int
+	timer  *time.Timer
+	busy   chan struct{} // Closed when the connection is opened or checked
+}
+
+// ErrNotInUse is returned by Put for a connection that has been returned as many
+// times as it was received from Get.
+var ErrNotInUse = errors.New("connection is not in use")
+
+// Get returns a connection to the Tracer on portName, opening it if needed. The
+// connection must be returned with Put when done. The Pool is not locked while a
+// connection is opened or checked, so a port that does not respond only delays
+// the callers of that port.
+func (p *Pool) Get(portName string) (*Tracer, error) {
+	for {
+		p.mu.Lock()
+		if p.closed {
+			p.mu.Unlock()
+			return nil, ErrPoolClosed
+		}
+		if p.conns == nil {
+			p.conns = make(map[string]*pooledTracer)
+		}
+
+		c, ok := p.conns[portName]
+		if ok && c.busy != nil {
+			// Another Get is opening or checking the connection.
+			busy := c.busy
+			p.mu.Unlock()
+			<-busy
+			continue
+		}
+		if ok && (c.users > 0 || p.HealthCheck == nil) {
+			if c.timer != nil {
+				c.timer.Stop()
+			}
+			c.users++
+			p.mu.Unlock()
+			return c.tracer, nil
+		}
+		if ok {
+			if c.timer != nil {
+				c.timer.Stop()
+			}
+			c.busy = make(chan struct{})
+			p.mu.Unlock()
+			err := p.HealthCheck(c.tracer)
+			p.mu.Lock()
+			close(c.busy)
+			c.busy = nil
+			if p.conns[portName] != c {
+				// Closed by Close while checked.
+				p.mu.Unlock()
+				continue
+			}
+			if err == nil {
+				c.users++
+				p.mu.Unlock()
+				return c.tracer, nil
+			}
+			delete(p.conns, portName)
+			p.mu.Unlock()
+			c.tracer.Close()
+			continue
+		}
+
+		c = &pooledTracer{busy: make(chan struct{})}
+		p.conns[portName] = c
+		p.mu.Unlock()
+		t, err := Open(portName, p.Options...)
+		p.mu.Lock()
+		close(c.busy)
+		c.busy = nil
+		current := p.conns[portName] == c
+		if current && err != nil {
+			delete(p.conns, portName)
+		}
+		if err == nil && current {
+			c.tracer, c.users = t, 1
+		}
+		p.mu.Unlock()
+		if err != nil {
+			return nil, err
+		}
+		if !current {
+			t.Close()
+			return nil, ErrPoolClosed
+		}
+		return t, nil
+	}
+}
+
+// Put returns a connection received from Get to the Pool. Returning it more times
+// than it was received fails with ErrNotInUse and leaves it to its other users.
+func (p *Pool) Put(t *Tracer) error {
+	p.mu.Lock()
+	defer p.mu.Unlock()
+	c, ok := p.conns[t.portName]
+	if !ok || c.tracer != t {
+		// Not from this Pool or the Pool is closed.
+		t.Close()
+		return nil
+	}
+	if c.users == 0 {
+		return ErrNotInUse
+	}
+
+	c.users--
+	if c.users > 0 || p.IdleTimeout == 0 {
+		return nil
+	}
+	c.timer = time.AfterFunc(p.IdleTimeout, func() {
+		p.mu.Lock()
+		defer p.mu.Unlock()
+		if p.conns[t.portName] == c && c.users == 0 && c.busy == nil {
+			c.tracer.Close()
+			delete(p.conns, t.portName)
+		}
+	})
+	return nil
+}
+
+// Close closes all connections in the Pool, including those in use.
+func (p *Pool) Close() error {
+	p.mu.Lock()
+	defer p.mu.Unlock()
+	p.closed = true
+	var errs []error
+	for name, c := range p.conns {
+		if c.timer != nil {
+			c.timer.Stop()
+		}
+		if c.tracer == nil {
+			// Still being opened, Get closes it.
+			delete(p.conns, name)
+			continue
+		}
+		if err := c.tracer.Close(); err != nil {
+			errs = append(errs, err)
+		}
+		delete(p.conns, name)
+	}
+	return errors.Join(errs...)
+}
@@ -0,0 +1,108 @@
+// Copyright (c) 2015, Roland Bali (roland.bali@spagettikod.se), Spagettikod
+// All rights reserved.
+//
+// Redistribution and use in source and binary forms, with or without modification,
+// are permitted provided that the following conditions are met:
+//
+// 1. Redistributions of source code must retain the above copyright notice, this
+//    list of conditions and the following disclaimer.
+//
+// 2. Redistributions in binary form must reproduce the above copyright notice, this
+//    list of conditions and the following disclaimer in the documentation and/or
+//    other materials provided with the distribution.
+//
+// 3. Neither the name of the copyright holder nor the names of its contributors may
+//    be used to endorse or promote products derived from this software without
+//    specific prior written permission.
+//
+// THIS SOFTWARE IS PROVIDED BY THE COPYRIGHT HOLDERS AND CONTRIBUTORS "AS IS" AND
+// ANY EXPRESS OR IMPLIED WARRANTIES, INCLUDING, BUT NOT LIMITED TO, THE IMPLIED
+// WARRANTIES OF MERCHANTABILITY AND FITNESS FOR A PARTICULAR PURPOSE ARE DISCLAIMED.
+// IN NO EVENT SHALL THE COPYRIGHT HOLDER OR CONTRIBUTORS BE LIABLE FOR ANY DIRECT,
+// INDIRECT, INCIDENTAL, SPECIAL, EXEMPLARY, OR CONSEQUENTIAL DAMAGES (INCLUDING, BUT
+// NOT LIMITED TO, PROCUREMENT OF SUBSTITUTE GOODS OR SERVICES; LOSS OF USE, DATA, OR
+// PROFITS; OR BUSINESS INTERRUPTION) HOWEVER CAUSED AND ON ANY THEORY OF LIABILITY,
+// WHETHER IN CONTRACT, STRICT LIABILITY, OR TORT (INCLUDING NEGLIGENCE OR OTHERWISE)
+// ARISING IN ANY WAY OUT OF THE USE OF THIS SOFTWARE, EVEN IF ADVISED OF THE
+// POSSIBILITY OF SUCH DAMAGE.
+
+package gotracer
+
+import (
+	"errors"
+	"testing"
+	"time"
+)
+
+func TestPoolGetNotBlockedBySlowPort(t *testing.T) {
+	release := make(chan struct{})
+	checking := make(chan struct{})
+	slow := newFakeTracer().tracer()
+	slow.portName = "slow"
+	p := &Pool{HealthCheck: func(tr *Tracer) error {
+		if tr == slow {
+			close(checking)
+			<-release
+		}
+		return nil
+	}}
+	p.conns = map[string]*pooledTracer{"slow": {tracer: slow}}
+	defer p.Close()
+
+	slowDone := make(chan error)
+	go func() {
+		_, err := p.Get("slow")
+		slowDone <- err
+	}()
+	<-checking
+
+	// Another port is served, here failing to open, while the slow port is
+	// being checked.
+	done := make(chan error)
+	go func() {
+		_, err := p.Get("/nonexistent/port")
+		done <- err
+	}()
+	select {
+	case err := <-done:
+		if err == nil {
+			t.Error("opened a nonexistent port")
+		}
+	case <-time.After(time.Second):
+		t.Fatal("Get of another port blocked by the check of the slow port")
+	}
+	close(release)
+	if err := <-slowDone; err != nil {
+		t.Error(err)
+	}
+}
+
+func TestPoolDoublePut(t *testing.T) {
+	tr := newFakeTracer().tracer()
+	p := &Pool{IdleTimeout: 10 * time.Millisecond}
+	p.conns = map[string]*pooledTracer{"fake": {tracer: tr}}
+	defer p.Close()
+
+	got, err := p.Get("fake")
+	if err != nil || got != tr {
+		t.Fatalf("Get gave %p, %v", got, err)
+	}
+	if err := p.Put(got); err != nil {
+		t.Fatal(err)
+	}
+	if err := p.Put(got); !errors.Is(err, ErrNotInUse) {
+		t.Errorf("second Put gave %v, want ErrNotInUse", err)
+	}
+
+	// In use again: the earlier double Put must not let it be evicted.
+	if got, err = p.Get("fake"); err != nil || got != tr {
+		t.Fatalf("Get gave %p, %v", got, err)
+	}
+	time.Sleep(30 * time.Millisecond)
+	p.mu.Lock()
+	c, ok := p.conns["fake"]
+	p.mu.Unlock()
+	if !ok || c.users != 1 {
+		t.Errorf("connection in use evicted or miscounted: %v %+v", ok, c)
+	}
+}
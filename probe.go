@@ -0,0 +1,100 @@
+// Copyright (c) 2015, Roland Bali (roland.bali@spagettikod.se), Spagettikod
+// All rights reserved.
+//
+// Redistribution and use in source and binary forms, with or without modification,
+// are permitted provided that the following conditions are met:
+//
+// 1. Redistributions of source code must retain the above copyright notice, this
+//    list of conditions and the following disclaimer.
+//
+// 2. Redistributions in binary form must reproduce the above copyright notice, this
+//    list of conditions and the following disclaimer in the documentation and/or
+//    other materials provided with the distribution.
+//
+// 3. Neither the name of the copyright holder nor the names of its contributors may
+//    be used to endorse or promote products derived from this software without
+//    specific prior written permission.
+//
+// THIS SOFTWARE IS PROVIDED BY THE COPYRIGHT HOLDERS AND CONTRIBUTORS "AS IS" AND
+// ANY EXPRESS OR IMPLIED WARRANTIES, INCLUDING, BUT NOT LIMITED TO, THE IMPLIED
+// WARRANTIES OF MERCHANTABILITY AND FITNESS FOR A PARTICULAR PURPOSE ARE DISCLAIMED.
+// IN NO EVENT SHALL THE COPYRIGHT HOLDER OR CONTRIBUTORS BE LIABLE FOR ANY DIRECT,
+// INDIRECT, INCIDENTAL, SPECIAL, EXEMPLARY, OR CONSEQUENTIAL DAMAGES (INCLUDING, BUT
+// NOT LIMITED TO, PROCUREMENT OF SUBSTITUTE GOODS OR SERVICES; LOSS OF USE, DATA, OR
+// PROFITS; OR BUSINESS INTERRUPTION) HOWEVER CAUSED AND ON ANY THEORY OF LIABILITY,
+// WHETHER IN CONTRACT, STRICT LIABILITY, OR TORT (INCLUDING NEGLIGENCE OR OTHERWISE)
+// ARISING IN ANY WAY OUT OF THE USE OF THIS SOFTWARE, EVEN IF ADVISED OF THE
+// POSSIBILITY OF SUCH DAMAGE.
+
+package gotracer
+
+import (
+	"errors"
+	"fmt"
+	"io"
+	"sort"
+	"time"
+)
+
+// Number of round trips Latency measures.
+const latencySamples = 5
+
+// Latency measures the round trip time to the Tracer connected on specified
+// portName, from sending a command until the complete response is received.
+// The smallest command is sent a few times and the median time is returned.
+// On USB serial adapters the latency timer setting of the adapter has a large
+// effect on the result.
+func Latency(portName string, opts ...Option) (d time.Duration, err error) {
+	err = withPort(portName, opts, func(port io.ReadWriter, cfg config) error {
+		r := queryStateCommand[1]
+		samples := make([]time.Duration, latencySamples)
+		for i := range samples {
+			start := time.Now()
+			if err := writeRequest(port, cfg, r.data); err != nil {
+				return err
+			}
+			if _, err := readResponse(port, cfg, r.respLen); err != nil {
+				return err
+			}
+			samples[i] = time.Since(start)
+		}
+		sort.Slice(samples, func(i, j int) bool { return samples[i] < samples[j] })
+		d = samples[len(samples)/2]
+		return nil
+	})
+	return
+}
+
+// ErrBaudNotFound is returned by ProbeBaud when the Tracer does not respond
+// correctly at any of the baud rates.
+var ErrBaudNotFound = errors.New("no baud rate gave a valid response")
+
+// ProbeBaud finds the baud rate of the Tracer connected on specified portName by
+// sending a small command at each of the candidate rates in turn and returns the
+// first rate getting a response with a valid checksum. At a wrong rate the
+// response is usually garbage rather than missing, which fails the checksum.
+// Pass the working rate to WithBaudRate. A rate the port fails to open or
+// communicate at is skipped, the errors are joined with ErrBaudNotFound if no rate
+// works.
+func ProbeBaud(portName string, candidates []int, opts ...Option) (int, error) {
+	errs := []error{ErrBaudNotFound}
+	for _, baud := range candidates {
+		err := withPort(portName, append(opts[:len(opts):len(opts)], WithBaudRate(baud)), func(port io.ReadWriter, cfg config) error {
+			_, err := send(port, cfg, queryStateCommand[1])
+			return err
+		})
+		if err == nil {
+			return baud, nil
+		}
+		var e *ModbusException
+		if errors.As(err, &e) {
+			// A valid exception response still means the rate is right.
+			return baud, nil
+		}
+		if err != ErrChecksum && err != ErrConnectTimeout && err != ErrReadTimeout {
+			// Some adapters reject some rates, try the remaining ones.
+			errs = append(errs, fmt.Errorf("baud rate %d: %w", baud, err))
+		}
+	}
+	return 0, errors.Join(errs...)
+}
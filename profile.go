@@ -0,0 +1,88 @@
+// Copyright (c) 2015, Roland Bali (roland.bali@spagettikod.se), Spagettikod
+// All rights reserved.
+//
+// Redistribution and use in source and binary forms, with or without modification,
+// are permitted provided that the following conditions are met:
+//
+// 1. Redistributions of source code must retain the above copyright notice, this
+//    list of conditions and the following disclaimer.
+//
+// 2. Redistributions in binary form must reproduce the above copyright notice, this
+//    list of conditions and the following disclaimer in the documentation and/or
+//    other materials provided with the distribution.
+//
+// 3. Neither the name of the copyright holder nor the names of its contributors may
+//    be used to endorse or promote products derived from this software without
+//    specific prior written permission.
+//
+// THIS SOFTWARE IS PROVIDED BY THE COPYRIGHT HOLDERS AND CONTRIBUTORS "AS IS" AND
+// ANY EXPRESS OR IMPLIED WARRANTIES, INCLUDING, BUT NOT LIMITED TO, THE IMPLIED
+// WARRANTIES OF MERCHANTABILITY AND FITNESS FOR A PARTICULAR PURPOSE ARE DISCLAIMED.
+// IN NO EVENT SHALL THE COPYRIGHT HOLDER OR CONTRIBUTORS BE LIABLE FOR ANY DIRECT,
+// INDIRECT, INCIDENTAL, SPECIAL, EXEMPLARY, OR CONSEQUENTIAL DAMAGES (INCLUDING, BUT
+// NOT LIMITED TO, PROCUREMENT OF SUBSTITUTE GOODS OR SERVICES; LOSS OF USE, DATA, OR
+// PROFITS; OR BUSINESS INTERRUPTION) HOWEVER CAUSED AND ON ANY THEORY OF LIABILITY,
+// WHETHER IN CONTRACT, STRICT LIABILITY, OR TORT (INCLUDING NEGLIGENCE OR OTHERWISE)
+// ARISING IN ANY WAY OUT OF THE USE OF THIS SOFTWARE, EVEN IF ADVISED OF THE
+// POSSIBILITY OF SUCH DAMAGE.
+
+package gotracer
+
+import "io"
+
+// Profile describes the capabilities of a Tracer model that affect how its
+// status is read.
+type Profile struct {
+	Name    string // Model or series name
+	HasLoad bool   // True if the controller has a load terminal
+}
+
+// ProfileBN is the profile of the Tracer BN series and the one used by default.
+var ProfileBN = Profile{Name: "BN", HasLoad: true}
+
+// WithProfile sets the profile of the connected Tracer. Use it for models
+// without a load terminal to avoid reporting meaningless load values.
+func WithProfile(p Profile) Option {
+	return func(c *config) {
+		c.profile = p
+	}
+}
+
+// ProfileNoLoad is the profile of models without a load terminal.
+var ProfileNoLoad = Profile{Name: "no load", HasLoad: false}
+
+// WithAutoProfile makes Open, and functions such as Status opening the port for
+// each call, detect the profile of the connected Tracer, see DetectProfile,
+// instead of using ProfileBN or the one set by WithProfile. It costs one more
+// command each time the port is opened.
+func WithAutoProfile() Option {
+	return func(c *config) {
+		c.autoProfile = true
+	}
+}
+
+// DetectProfile reads the rated data of the Tracer connected on specified
+// portName and returns the profile matching it. A Tracer with a rated load
+// current of zero has no load terminal and gets ProfileNoLoad, any other gets
+// ProfileBN. ErrNotTracer is returned if the rated array voltage is zero.
+func DetectProfile(portName string, opts ...Option) (p Profile, err error) {
+	err = withPort(portName, opts, func(port io.ReadWriter, cfg config) error {
+		p, err = detectProfile(port, cfg)
+		return err
+	})
+	return
+}
+
+func detectProfile(port io.ReadWriter, cfg config) (Profile, error) {
+	rated, err := readRegisters(port, cfg, funcReadInputRegisters, regRatedArrayVoltage, regRatedLoadCurrent-regRatedArrayVoltage+1)
+	if err != nil {
+		return Profile{}, err
+	}
+	if rated[0] == 0 {
+		return Profile{}, ErrNotTracer
+	}
+	if rated[regRatedLoadCurrent-regRatedArrayVoltage] == 0 {
+		return ProfileNoLoad, nil
+	}
+	return ProfileBN, nil
+}
@@ -0,0 +1,117 @@
+// Copyright (c) 2015, Roland Bali (roland.bali@spagettikod.se), Spagettikod
+// All rights reserved.
+//
+// Redistribution and use in source and binary forms, with or without modification,
+// are permitted provided that the following conditions are met:
+//
+// 1. Redistributions of source code must retain the above copyright notice, this
+//    list of conditions and the following disclaimer.
+//
+// 2. Redistributions in binary form must reproduce the above copyright notice, this
+//    list of conditions and the following disclaimer in the documentation and/or
+//    other materials provided with the distribution.
+//
+// 3. Neither the name of the copyright holder nor the names of its contributors may
+//    be used to endorse or promote products derived from this software without
+//    specific prior written permission.
+//
+// THIS SOFTWARE IS PROVIDED BY THE COPYRIGHT HOLDERS AND CONTRIBUTORS "AS IS" AND
+// ANY EXPRESS OR IMPLIED WARRANTIES, INCLUDING, BUT NOT LIMITED TO, THE IMPLIED
+// WARRANTIES OF MERCHANTABILITY AND FITNESS FOR A PARTICULAR PURPOSE ARE DISCLAIMED.
+// IN NO EVENT SHALL THE COPYRIGHT HOLDER OR CONTRIBUTORS BE LIABLE FOR ANY DIRECT,
+// INDIRECT, INCIDENTAL, SPECIAL, EXEMPLARY, OR CONSEQUENTIAL DAMAGES (INCLUDING, BUT
+// NOT LIMITED TO, PROCUREMENT OF SUBSTITUTE GOODS OR SERVICES; LOSS OF USE, DATA, OR
+// PROFITS; OR BUSINESS INTERRUPTION) HOWEVER CAUSED AND ON ANY THEORY OF LIABILITY,
+// WHETHER IN CONTRACT, STRICT LIABILITY, OR TORT (INCLUDING NEGLIGENCE OR OTHERWISE)
+// ARISING IN ANY WAY OUT OF THE USE OF THIS SOFTWARE, EVEN IF ADVISED OF THE
+// POSSIBILITY OF SUCH DAMAGE.
+
+package gotracer
+
+import (
+	"errors"
+	"fmt"
+	"io"
+	"sync"
+	"time"
+)
+
+// ErrRateLimited is returned by a non-blocking RateLimiter when a port is busy or
+// was used too recently.
+var ErrRateLimited = errors.New("too many requests to Tracer")
+
+// RateLimiter serializes access to serial ports and paces it to a maximum number
+// of operations per second for each port. An operation is a complete call such
+// as Status or SetLoad. Use the same RateLimiter, by passing it with
+// WithRateLimiter, for all calls that may run concurrently.
+type RateLimiter struct {
+	interval time.Duration
+	block    bool
+
+	mu    sync.Mutex
+	ports map[string]*portLimit
+}
+
+type portLimit struct {
+	mu   sync.Mutex
+	last time.Time
+}
+
+// NewRateLimiter returns a RateLimiter allowing perSecond operations per second
+// on each port. When block is true operations wait for their turn, otherwise
+// they fail with ErrRateLimited. It panics if perSecond is not positive.
+func NewRateLimiter(perSecond float64, block bool) *RateLimiter {
+	if !(perSecond > 0) {
+		panic(fmt.Sprintf("gotracer: rate limit of %v operations per second is not positive", perSecond))
+	}
+	return &RateLimiter{
+		interval: time.Duration(float64(time.Second) / perSecond),
+		block:    block,
+		ports:    make(map[string]*portLimit),
+	}
+}
+
+// Waits for, or fails if not blocking, exclusive access to portName. The
+// returned function must be called when done with the port.
+func (l *RateLimiter) acquire(portName string) (release func(), err error) {
+	l.mu.Lock()
+	p, ok := l.ports[portName]
+	if !ok {
+		p = &portLimit{}
+		l.ports[portName] = p
+	}
+	l.mu.Unlock()
+
+	if l.block {
+		p.mu.Lock()
+		time.Sleep(time.Until(p.last.Add(l.interval)))
+	} else {
+		if !p.mu.TryLock() {
+			return nil, ErrRateLimited
+		}
+		if time.Now().Before(p.last.Add(l.interval)) {
+			p.mu.Unlock()
+			return nil, ErrRateLimited
+		}
+	}
+	p.last = time.Now()
+	return p.mu.Unlock, nil
+}
+
+// A port that releases its rate limiter when closed.
+type limitedPort struct {
+	io.ReadWriteCloser
+	release func()
+}
+
+func (p *limitedPort) Close() error {
+	defer p.release()
+	return p.ReadWriteCloser.Close()
+}
+
+func (p *limitedPort) Flush() error {
+	if f, ok := p.ReadWriteCloser.(interface{ Flush() error }); ok {
+		return f.Flush()
+	}
+	return nil
+}
@@ -0,0 +1,98 @@
+// Copyright (c) 2015, Roland Bali (roland.bali@spagettikod.se), Spagettikod
+// All rights reserved.
+//
+// Redistribution and use in source and binary forms, with or without modification,
+// are permitted provided that the following conditions are met:
+//
+// 1. Redistributions of source code must retain the above copyright notice, this
+//    list of conditions and the following disclaimer.
+//
+// 2. Redistributions in binary form must reproduce the above copyright notice, this
+//    list of conditions and the following disclaimer in the documentation and/or
+//    other materials provided with the distribution.
+//
+// 3. Neither the name of the copyright holder nor the names of its contributors may
+//    be used to endorse or promote products derived from this software without
+//    specific prior written permission.
+//
+// THIS SOFTWARE IS PROVIDED BY THE COPYRIGHT HOLDERS AND CONTRIBUTORS "AS IS" AND
+// ANY EXPRESS OR IMPLIED WARRANTIES, INCLUDING, BUT NOT LIMITED TO, THE IMPLIED
+// WARRANTIES OF MERCHANTABILITY AND FITNESS FOR A PARTICULAR PURPOSE ARE DISCLAIMED.
+// IN NO EVENT SHALL THE COPYRIGHT HOLDER OR CONTRIBUTORS BE LIABLE FOR ANY DIRECT,
+// INDIRECT, INCIDENTAL, SPECIAL, EXEMPLARY, OR CONSEQUENTIAL DAMAGES (INCLUDING, BUT
+// NOT LIMITED TO, PROCUREMENT OF SUBSTITUTE GOODS OR SERVICES; LOSS OF USE, DATA, OR
+// PROFITS; OR BUSINESS INTERRUPTION) HOWEVER CAUSED AND ON ANY THEORY OF LIABILITY,
+// WHETHER IN CONTRACT, STRICT LIABILITY, OR TORT (INCLUDING NEGLIGENCE OR OTHERWISE)
+// ARISING IN ANY WAY OUT OF THE USE OF THIS SOFTWARE, EVEN IF ADVISED OF THE
+// POSSIBILITY OF SUCH DAMAGE.
+
+package gotracer
+
+import (
+	"testing"
+	"time"
+)
+
+func TestRateLimiterBlocking(t *testing.T) {
+	l := NewRateLimiter(20, true) // 50ms between operations
+	release, err := l.acquire("a")
+	if err != nil {
+		t.Fatal(err)
+	}
+	start := time.Now()
+	go func() {
+		time.Sleep(10 * time.Millisecond)
+		release()
+	}()
+	release, err = l.acquire("a")
+	if err != nil {
+		t.Fatal(err)
+	}
+	release()
+	if d := time.Since(start); d < 45*time.Millisecond {
+		t.Errorf("second operation started after %v, want at least 50ms", d)
+	}
+
+	start = time.Now()
+	if release, err = l.acquire("b"); err != nil {
+		t.Fatal(err)
+	}
+	release()
+	if d := time.Since(start); d > 20*time.Millisecond {
+		t.Errorf("operation on another port waited %v", d)
+	}
+}
+
+func TestRateLimiterNonBlocking(t *testing.T) {
+	l := NewRateLimiter(20, false)
+	release, err := l.acquire("a")
+	if err != nil {
+		t.Fatal(err)
+	}
+	if _, err := l.acquire("a"); err != ErrRateLimited {
+		t.Errorf("port in use gave %v, want ErrRateLimited", err)
+	}
+	release()
+	if _, err := l.acquire("a"); err != ErrRateLimited {
+		t.Errorf("port used too recently gave %v, want ErrRateLimited", err)
+	}
+	time.Sleep(60 * time.Millisecond)
+	if release, err = l.acquire("a"); err != nil {
+		t.Errorf("port free again gave %v", err)
+	} else {
+		release()
+	}
+}
+
+func TestNewRateLimiterNotPositive(t *testing.T) {
+	for _, perSecond := range []float64{0, -1} {
+		func() {
+			defer func() {
+				if recover() == nil {
+					t.Errorf("NewRateLimiter(%v) did not panic", perSecond)
+				}
+			}()
+			NewRateLimiter(perSecond, true)
+		}()
+	}
+}
@@ -0,0 +1,219 @@
+// Copyright (c) 2015, Roland Bali (roland.bali@spagettikod.se), Spagettikod
+// All rights reserved.
+//
+// Redistribution and use in source and binary forms, with or without modification,
+// are permitted provided that the following conditions are met:
+//
+// 1. Redistributions of source code must retain the above copyright notice, this
+//    list of conditions and the following disclaimer.
+//
+// 2. Redistributions in binary form must reproduce the above copyright notice, this
+//    list of conditions and the following disclaimer in the documentation and/or
+//    other materials provided with the distribution.
+//
+// 3. Neither the name of the copyright holder nor the names of its contributors may
+//    be used to endorse or promote products derived from this software without
+//    specific prior written permission.
+//
+// THIS SOFTWARE IS PROVIDED BY THE COPYRIGHT HOLDERS AND CONTRIBUTORS "AS IS" AND
+// ANY EXPRESS OR IMPLIED WARRANTIES, INCLUDING, BUT NOT LIMITED TO, THE IMPLIED
+// WARRANTIES OF MERCHANTABILITY AND FITNESS FOR A PARTICULAR PURPOSE ARE DISCLAIMED.
+// IN NO EVENT SHALL THE COPYRIGHT HOLDER OR CONTRIBUTORS BE LIABLE FOR ANY DIRECT,
+// INDIRECT, INCIDENTAL, SPECIAL, EXEMPLARY, OR CONSEQUENTIAL DAMAGES (INCLUDING, BUT
+// NOT LIMITED TO, PROCUREMENT OF SUBSTITUTE GOODS OR SERVICES; LOSS OF USE, DATA, OR
+// PROFITS; OR BUSINESS INTERRUPTION) HOWEVER CAUSED AND ON ANY THEORY OF LIABILITY,
+// WHETHER IN CONTRACT, STRICT LIABILITY, OR TORT (INCLUDING NEGLIGENCE OR OTHERWISE)
+// ARISING IN ANY WAY OUT OF THE USE OF THIS SOFTWARE, EVEN IF ADVISED OF THE
+// POSSIBILITY OF SUCH DAMAGE.
+
+package gotracer
+
+import (
+	"errors"
+	"math"
+	"reflect"
+	"strings"
+	"time"
+)
+
+// Size of the buffer the status command responses are assembled in.
+var statusBufferSize = bufferSize(queryStateCommand)
+
+// ErrShortBuffer is returned when decoding status from a buffer that is shorter
+// than the assembled responses of the status commands, or when a response does
+// not fit in the buffer it is assembled in.
+var ErrShortBuffer = errors.New("status buffer too short")
+
+// RawStatus contain the register values read from Tracer before they are scaled
+// into a TracerStatus. Voltages, currents, powers, temperatures and energies are
+// 100 times their value in TracerStatus. Temperatures and battery current are
+// signed values stored as two's complement.
+type RawStatus struct {
+	BatteryStatus          uint16    `json:"bstatus"` // Battery status register
+	ChargingStatus         uint16    `json:"cstatus"` // Charging equipment status register
+	DischargingStatus      uint16    `json:"dstatus"` // Discharging equipment status register
+	DeviceOverTemp         bool      `json:"devot"`   // Over temperature inside the Tracer
+	ArrayVoltage           uint16    `json:"pvv"`     // Solar panel voltage, (V*100)
+	ArrayCurrent           uint16    `json:"pvc"`     // Solar panel current, (A*100)
+	ArrayPower             uint16    `json:"pvp"`     // Solar panel power, (W*100)
+	BatteryVoltage         uint16    `json:"bv"`      // Battery voltage, (V*100)
+	BatteryCurrent         uint16    `json:"bc"`      // Battery current, signed, (A*100)
+	BatterySOC             uint16    `json:"bsoc"`    // Battery state of charge, (%)
+	BatteryTemp            uint16    `json:"btemp"`   // Battery temperature, signed, (C*100)
+	BatteryMaxVoltage      uint16    `json:"bmaxv"`   // Battery maximum voltage, (V*100)
+	BatteryMinVoltage      uint16    `json:"bminv"`   // Battery lowest voltage, (V*100)
+	DeviceTemp             uint16    `json:"devtemp"` // Tracer temperature, signed, (C*100)
+	HeatsinkTemp           uint16    `json:"hstemp"`  // Power components temperature, signed, (C*100)
+	LoadVoltage            uint16    `json:"lv"`      // Load voltage, (V*100)
+	LoadCurrent            uint16    `json:"lc"`      // Load current, (A*100)
+	LoadPower              uint16    `json:"lp"`      // Load power, (W*100)
+	LoadMode               uint16    `json:"lmode"`   // Load control mode setting
+	NoLoad                 bool      `json:"noload"`  // Controller has no load terminal, load values are not set
+	EnergyConsumedDaily    uint32    `json:"ecd"`     // Tracer calculated daily consumption, (kWh*100)
+	EnergyConsumedMonthly  uint32    `json:"ecm"`     // Tracer calculated monthly consumption, (kWh*100)
+	EnergyConsumedAnnual   uint32    `json:"eca"`     // Tracer calculated annual consumption, (kWh*100)
+	EnergyConsumedTotal    uint32    `json:"ect"`     // Tracer calculated total consumption, (kWh*100)
+	EnergyGeneratedDaily   uint32    `json:"egd"`     // Tracer calculated daily power generation, (kWh*100)
+	EnergyGeneratedMonthly uint32    `json:"egm"`     // Tracer calculated monthly power generation, (kWh*100)
+	EnergyGeneratedAnnual  uint32    `json:"ega"`     // Tracer calculated annual power generation, (kWh*100)
+	EnergyGeneratedTotal   uint32    `json:"egt"`     // Tracer calculated total power generation, (kWh*100)
+	Timestamp              time.Time `json:"t"`
+}
+
+// Extracts the register values from the assembled command responses. The energy
+// counters of the statistics response, at offset 79, are pairs of registers
+// holding the low word first.
+func decodeRaw(buffer []byte) (RawStatus, error) {
+	if len(buffer) < statusBufferSize {
+		return RawStatus{}, ErrShortBuffer
+	}
+	return RawStatus{
+		BatteryStatus:          uint16(unpack(buffer[3:5])),
+		ChargingStatus:         uint16(unpack(buffer[5:7])),
+		DischargingStatus:      uint16(unpack(buffer[7:9])),
+		DeviceOverTemp:         buffer[14]&1 == 1,
+		ArrayVoltage:           uint16(unpack(buffer[24:26])),
+		ArrayCurrent:           uint16(unpack(buffer[26:28])),
+		ArrayPower:             uint16(unpack(buffer[28:30])),
+		BatteryVoltage:         uint16(unpack(buffer[32:34])),
+		LoadVoltage:            uint16(unpack(buffer[40:42])),
+		LoadCurrent:            uint16(unpack(buffer[42:44])),
+		LoadPower:              uint16(unpack(buffer[44:46])),
+		LoadMode:               uint16(unpack(buffer[123:125])),
+		BatteryTemp:            uint16(unpack(buffer[56:58])),
+		DeviceTemp:             uint16(unpack(buffer[58:60])),
+		HeatsinkTemp:           uint16(unpack(buffer[130:132])),
+		BatterySOC:             uint16(unpack(buffer[64:66])),
+		BatteryCurrent:         uint16(unpack(buffer[73:75])),
+		BatteryMaxVoltage:      uint16(unpack(buffer[82:84])),
+		BatteryMinVoltage:      uint16(unpack(buffer[84:86])),
+		EnergyConsumedDaily:    unpackLowFirst(buffer[86:90]),
+		EnergyConsumedMonthly:  unpackLowFirst(buffer[90:94]),
+		EnergyConsumedAnnual:   unpackLowFirst(buffer[94:98]),
+		EnergyConsumedTotal:    unpackLowFirst(buffer[98:102]),
+		EnergyGeneratedDaily:   unpackLowFirst(buffer[102:106]),
+		EnergyGeneratedMonthly: unpackLowFirst(buffer[106:110]),
+		EnergyGeneratedAnnual:  unpackLowFirst(buffer[110:114]),
+		EnergyGeneratedTotal:   unpackLowFirst(buffer[114:118]),
+	}, nil
+}
+
+// Returns the 32-bit value of the register pair in b, low word first.
+func unpackLowFirst(b []byte) uint32 {
+	return unpack(b[2:4])<<16 | unpack(b[0:2])
+}
+
+// Values returns the register values keyed by their JSON names, flags as 0 or 1.
+func (r RawStatus) Values() map[string]uint32 {
+	m := make(map[string]uint32)
+	v := reflect.ValueOf(r)
+	for i := 0; i < v.NumField(); i++ {
+		name := strings.Split(v.Type().Field(i).Tag.Get("json"), ",")[0]
+		switch f := v.Field(i); f.Kind() {
+		case reflect.Uint16, reflect.Uint32:
+			m[name] = uint32(f.Uint())
+		case reflect.Bool:
+			if f.Bool() {
+				m[name] = 1
+			} else {
+				m[name] = 0
+			}
+		}
+	}
+	return m
+}
+
+// RegisterValue converts a voltage, current, power or temperature of a reading
+// or setting back into its 16-bit register value, 100 times the value. It rounds
+// to the nearest integer so a value read from the Tracer converts back to the
+// exact register value it was read from. Negative values are returned as two's
+// complement.
+func RegisterValue(v float32) uint16 {
+	return uint16(int32(math.Round(float64(v) * 100)))
+}
+
+// Scaled converts the register values into a TracerStatus.
+func (r RawStatus) Scaled() (t TracerStatus) {
+	t.Timestamp = r.Timestamp
+
+	t.ArrayVoltage = float32(r.ArrayVoltage) / 100
+	t.ArrayCurrent = float32(r.ArrayCurrent) / 100
+	t.ArrayPower = float32(r.ArrayPower) / 100
+	t.BatteryVoltage = float32(r.BatteryVoltage) / 100
+
+	t.BatteryStatus = decodeBatteryStatus(r.BatteryStatus)
+	t.ChargingFaults = decodeChargingFaults(r.ChargingStatus)
+
+	// Bits 15-14 of charging equipment status is the input voltage status,
+	// 2 means the array voltage is higher than the controller allows.
+	t.ArrayOverVoltage = r.ChargingStatus>>14 == 2
+
+	if !r.NoLoad {
+		t.Load = byte(r.DischargingStatus) == 1
+		t.LoadVoltage = float32(r.LoadVoltage) / 100
+		t.LoadCurrent = float32(r.LoadCurrent) / 100
+		t.LoadPower = float32(r.LoadPower) / 100
+		t.LoadState = r.loadState()
+	} else {
+		t.NoLoad = true
+	}
+
+	// Temperatures and battery current can be negative.
+	t.BatteryTemp = float32(int16(r.BatteryTemp)) / 100
+	t.DeviceTemp = float32(int16(r.DeviceTemp)) / 100
+	t.HeatsinkTemp = float32(int16(r.HeatsinkTemp)) / 100
+	t.BatteryCurrent = float32(int16(r.BatteryCurrent)) / 100
+
+	t.BatterySOC = int32(r.BatterySOC)
+	t.BatteryMaxVoltage = float32(r.BatteryMaxVoltage) / 100
+	t.BatteryMinVoltage = float32(r.BatteryMinVoltage) / 100
+	t.EnergyConsumedDaily = float32(r.EnergyConsumedDaily) / 100
+	t.EnergyConsumedMonthly = float32(r.EnergyConsumedMonthly) / 100
+	t.EnergyConsumedAnnual = float32(r.EnergyConsumedAnnual) / 100
+	t.EnergyConsumedTotal = float32(r.EnergyConsumedTotal) / 100
+	t.EnergyGeneratedDaily = float32(r.EnergyGeneratedDaily) / 100
+	t.EnergyGeneratedMonthly = float32(r.EnergyGeneratedMonthly) / 100
+	t.EnergyGeneratedAnnual = float32(r.EnergyGeneratedAnnual) / 100
+	t.EnergyGeneratedTotal = float32(r.EnergyGeneratedTotal) / 100
+
+	return
+}
+
+// Decodes why the load is off, if it is, from the status registers and the load
+// control mode.
+func (r RawStatus) loadState() LoadState {
+	if r.DischargingStatus&1 == 1 {
+		return LoadOn
+	}
+	// Fault, output short circuit, overload or output voltage abnormal.
+	const faults = 1<<1 | 1<<8 | 1<<11
+	overload := r.DischargingStatus>>12&3 == 3
+	lvd := BatteryVoltageState(r.BatteryStatus&0x000f) == BatteryLowVoltageDisconnect
+	if r.DischargingStatus&faults != 0 || overload || lvd || r.DeviceOverTemp {
+		return LoadOffProtection
+	}
+	if LoadMode(r.LoadMode) == LoadModeManual {
+		return LoadOffManual
+	}
+	return LoadOffTimer
+}
@@ -0,0 +1,104 @@
+// Copyright (c) 2015, Roland Bali (roland.bali@spagettikod.se), Spagettikod
+// All rights reserved.
+//
+// Redistribution and use in source and binary forms, with or without modification,
+// are permitted provided that the following conditions are met:
+//
+// 1. Redistributions of source code must retain the above copyright notice, this
+//    list of conditions and the following disclaimer.
+//
+// 2. Redistributions in binary form must reproduce the above copyright notice, this
+//    list of conditions and the following disclaimer in the documentation and/or
+//    other materials provided with the distribution.
+//
+// 3. Neither the name of the copyright holder nor the names of its contributors may
+//    be used to endorse or promote products derived from this software without
+//    specific prior written permission.
+//
+// THIS SOFTWARE IS PROVIDED BY THE COPYRIGHT HOLDERS AND CONTRIBUTORS "AS IS" AND
+// ANY EXPRESS OR IMPLIED WARRANTIES, INCLUDING, BUT NOT LIMITED TO, THE IMPLIED
+// WARRANTIES OF MERCHANTABILITY AND FITNESS FOR A PARTICULAR PURPOSE ARE DISCLAIMED.
+// IN NO EVENT SHALL THE COPYRIGHT HOLDER OR CONTRIBUTORS BE LIABLE FOR ANY DIRECT,
+// INDIRECT, INCIDENTAL, SPECIAL, EXEMPLARY, OR CONSEQUENTIAL DAMAGES (INCLUDING, BUT
+// NOT LIMITED TO, PROCUREMENT OF SUBSTITUTE GOODS OR SERVICES; LOSS OF USE, DATA, OR
+// PROFITS; OR BUSINESS INTERRUPTION) HOWEVER CAUSED AND ON ANY THEORY OF LIABILITY,
+// WHETHER IN CONTRACT, STRICT LIABILITY, OR TORT (INCLUDING NEGLIGENCE OR OTHERWISE)
+// ARISING IN ANY WAY OUT OF THE USE OF THIS SOFTWARE, EVEN IF ADVISED OF THE
+// POSSIBILITY OF SUCH DAMAGE.
+
+package gotracer
+
+import "testing"
+
+func TestDecodeRawStatistics(t *testing.T) {
+	// Response to reading 18 input registers from 0x3302, the energy counters
+	// are register pairs holding the low word first.
+	frame := appendCRC([]byte{0x01, 0x04, 0x24,
+		0x05, 0xa0, // 0x3302 maximum battery voltage today
+		0x04, 0xba, // 0x3303 minimum battery voltage today
+		0x00, 0x02, 0x00, 0x01, // 0x3304 consumed today
+		0x00, 0x04, 0x00, 0x03, // 0x3306 consumed this month
+		0x00, 0x06, 0x00, 0x05, // 0x3308 consumed this year
+		0x00, 0x08, 0x00, 0x07, // 0x330a consumed in total
+		0x00, 0x0a, 0x00, 0x09, // 0x330c generated today
+		0x00, 0x0c, 0x00, 0x0b, // 0x330e generated this month
+		0x00, 0x0e, 0x00, 0x0d, // 0x3310 generated this year
+		0x00, 0x10, 0x00, 0x0f, // 0x3312 generated in total
+	})
+	c := queryStateCommand[4]
+	if len(frame) != c.respLen {
+		t.Fatalf("frame of %d bytes, want %d", len(frame), c.respLen)
+	}
+	buffer := make([]byte, statusBufferSize)
+	copy(buffer[c.offset:], frame)
+	r, err := decodeRaw(buffer)
+	if err != nil {
+		t.Fatal(err)
+	}
+	want := []struct {
+		name      string
+		got, want uint32
+	}{
+		{"BatteryMaxVoltage", uint32(r.BatteryMaxVoltage), 0x05a0},
+		{"BatteryMinVoltage", uint32(r.BatteryMinVoltage), 0x04ba},
+		{"EnergyConsumedDaily", r.EnergyConsumedDaily, 0x00010002},
+		{"EnergyConsumedMonthly", r.EnergyConsumedMonthly, 0x00030004},
+		{"EnergyConsumedAnnual", r.EnergyConsumedAnnual, 0x00050006},
+		{"EnergyConsumedTotal", r.EnergyConsumedTotal, 0x00070008},
+		{"EnergyGeneratedDaily", r.EnergyGeneratedDaily, 0x0009000a},
+		{"EnergyGeneratedMonthly", r.EnergyGeneratedMonthly, 0x000b000c},
+		{"EnergyGeneratedAnnual", r.EnergyGeneratedAnnual, 0x000d000e},
+		{"EnergyGeneratedTotal", r.EnergyGeneratedTotal, 0x000f0010},
+	}
+	for _, w := range want {
+		if w.got != w.want {
+			t.Errorf("%s %#08x, want %#08x", w.name, w.got, w.want)
+		}
+	}
+}
+
+func TestShortBuffer(t *testing.T) {
+	last := queryStateCommand[len(queryStateCommand)-1]
+	tests := []struct {
+		name string
+		run  func() error
+		err  error
+	}{
+		{"decode empty", func() error { _, err := decodeRaw(nil); return err }, ErrShortBuffer},
+		{"decode truncated", func() error { _, err := decodeRaw(make([]byte, statusBufferSize-1)); return err }, ErrShortBuffer},
+		{"decode complete", func() error { _, err := decodeRaw(make([]byte, statusBufferSize)); return err }, nil},
+		{"response overruns buffer", func() error {
+			f := newFakeTracer()
+			return query(f, f.tracer().cfg, make([]byte, last.offset+last.respLen-1), last)
+		}, ErrShortBuffer},
+		{"response fits buffer", func() error {
+			f := newFakeTracer()
+			return query(f, f.tracer().cfg, make([]byte, last.offset+last.respLen), last)
+		}, nil},
+	}
+	for _, tt := range tests {
+		if err := tt.run(); err != tt.err {
+			t.Errorf("%s: got %v, want %v", tt.name, err, tt.err)
+		}
+	}
+}
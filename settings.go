@@ -0,0 +1,604 @@
+// Copyright (c) 2015, Roland Bali (roland.bali@spagettikod.se), Spagettikod
+// All rights reserved.
+//
+// Redistribution and use in source and binary forms, with or without modification,
+// are permitted provided that the following conditions are met:
+//
+// 1. Redistributions of source code must retain the above copyright notice, this
+//    list of conditions and the following disclaimer.
+//
+// 2. Redistributions in binary form must reproduce the above copyright notice, this
+//    list of conditions and the following disclaimer in the documentation and/or
+//    other materials provided with the distribution.
+//
+// 3. Neither the name of the copyright holder nor the names of its contributors may
+//    be used to endorse or promote products derived from this software without
+//    specific prior written permission.
+//
+// THIS SOFTWARE IS PROVIDED BY THE COPYRIGHT HOLDERS AND CONTRIBUTORS "AS IS" AND
+// ANY EXPRESS OR IMPLIED WARRANTIES, INCLUDING, BUT NOT LIMITED TO, THE IMPLIED
+// WARRANTIES OF MERCHANTABILITY AND FITNESS FOR A PARTICULAR PURPOSE ARE DISCLAIMED.
+// IN NO EVENT SHALL THE COPYRIGHT HOLDER OR CONTRIBUTORS BE LIABLE FOR ANY DIRECT,
+// INDIRECT, INCIDENTAL, SPECIAL, EXEMPLARY, OR CONSEQUENTIAL DAMAGES (INCLUDING, BUT
+// NOT LIMITED TO, PROCUREMENT OF SUBSTITUTE GOODS OR SERVICES; LOSS OF USE, DATA, OR
+// PROFITS; OR BUSINESS INTERRUPTION) HOWEVER CAUSED AND ON ANY THEORY OF LIABILITY,
+// WHETHER IN CONTRACT, STRICT LIABILITY, OR TORT (INCLUDING NEGLIGENCE OR OTHERWISE)
+// ARISING IN ANY WAY OUT OF THE USE OF THIS SOFTWARE, EVEN IF ADVISED OF THE
+// POSSIBILITY OF SUCH DAMAGE.
+
+package gotracer
+
+import (
+	"fmt"
+	"io"
+	"time"
+)
+
+// Rated data input registers.
+const (
+	regRatedArrayVoltage   = 0x3000 // PV array rated voltage, (V*100)
+	regRatedArrayCurrent   = 0x3001 // PV array rated current, (A*100)
+	regRatedArrayPower     = 0x3002 // PV array rated power, low and high word, (W*100)
+	regRatedBatteryVoltage = 0x3004 // Rated voltage to the battery, (V*100)
+	regRatedChargeCurrent  = 0x3005 // Rated charging current to the battery, (A*100)
+	regRatedChargePower    = 0x3006 // Rated charging power to the battery, low and high word, (W*100)
+	regChargingMode        = 0x3008 // Charging mode
+	regRatedLoadCurrent    = 0x300e // Rated current of the load terminal, (A*100)
+)
+
+// Real-time data input registers.
+const (
+	regBatteryTemp        = 0x3110 // Battery temperature, signed, (C*100)
+	regSystemRatedVoltage = 0x311d // Rated voltage of the system currently in use, (V*100)
+)
+
+// Setting holding registers.
+const (
+	regBatteryType           = 0x9000 // Battery type
+	regBatteryCapacity       = 0x9001 // Battery capacity, (Ah)
+	regTempCompensation      = 0x9002 // Temperature compensation coefficient, (mV/C/2V*100)
+	regHighVoltageDisconnect = 0x9003 // First of the battery voltage settings, (V*100)
+	regEqualizationVoltage   = 0x9006 // Equalization charging voltage, (V*100)
+	regEqualizationInterval  = 0x9016 // Days between equalization charges
+	regNightThresholdVoltage = 0x901e // Night time threshold voltage, (V*100)
+	regNightDelay            = 0x901f // Delay before night is detected, (min)
+	regDayThresholdVoltage   = 0x9020 // Day time threshold voltage, (V*100)
+	regDayDelay              = 0x9021 // Delay before day is detected, (min)
+	regBacklightTime         = 0x9063 // Time the display backlight stays on, (s)
+	regBatteryRatedVoltage   = 0x9067 // Battery rated voltage code
+	regEqualizationDuration  = 0x906b // Equalization charging duration, (min)
+	regBoostDuration         = 0x906c // Boost charging duration, (min)
+	regDischargingPercentage = 0x906d // Depth of discharge, (%)
+	regChargingPercentage    = 0x906e // Depth of charge, (%)
+	regManagementMode        = 0x9070 // Battery charge and discharge management mode
+)
+
+// ArraySettings contain the limits the Tracer applies to the solar panel input.
+//
+// The BN series has no separate minimum startup voltage for charging. Charging
+// starts when the array voltage has risen above DayThresholdVoltage, and above
+// the battery voltage, and stops when it falls below NightThresholdVoltage.
+//
+// RatedChargeCurrent is the most the Tracer charges the battery with. The limit
+// actually enforced at a given moment, lowered for example by the device
+// temperature, is not available from the Tracer.
+type ArraySettings struct {
+	RatedVoltage          float32 `json:"pvratedv"` // Maximum array input voltage, (V)
+	RatedCurrent          float32 `json:"pvratedc"` // Maximum array input current, (A)
+	RatedChargeCurrent    float32 `json:"ratedcc"`  // Maximum battery charging current, (A)
+	DayThresholdVoltage   float32 `json:"dttv"`     // Array voltage above which it is considered day, (V)
+	NightThresholdVoltage float32 `json:"nttv"`     // Array voltage below which it is considered night, (V)
+}
+
+// ReadArraySettings reads the solar panel input limits from the Tracer connected
+// on specified portName.
+func ReadArraySettings(portName string, opts ...Option) (s ArraySettings, err error) {
+	err = withPort(portName, opts, func(port io.ReadWriter, cfg config) error {
+		s, err = readArraySettings(port, cfg)
+		return err
+	})
+	return
+}
+
+func readArraySettings(port io.ReadWriter, cfg config) (s ArraySettings, err error) {
+	rated, err := readRegisters(port, cfg, funcReadInputRegisters, regRatedArrayVoltage, regRatedChargeCurrent-regRatedArrayVoltage+1)
+	if err != nil {
+		return
+	}
+	s.RatedVoltage = float32(rated[0]) / 100
+	s.RatedCurrent = float32(rated[regRatedArrayCurrent-regRatedArrayVoltage]) / 100
+	s.RatedChargeCurrent = float32(rated[regRatedChargeCurrent-regRatedArrayVoltage]) / 100
+
+	// Night and day threshold voltages are separated by the night delay register.
+	thresholds, err := readRegisters(port, cfg, funcReadHoldingRegisters, regNightThresholdVoltage, 3)
+	if err != nil {
+		return
+	}
+	s.NightThresholdVoltage = float32(thresholds[0]) / 100
+	s.DayThresholdVoltage = float32(thresholds[regDayThresholdVoltage-regNightThresholdVoltage]) / 100
+	return
+}
+
+// RatedData contain the ratings of the Tracer, fixed by its model.
+type RatedData struct {
+	ArrayVoltage   float32 `json:"av"` // PV array rated voltage, (V)
+	ArrayCurrent   float32 `json:"ac"` // PV array rated current, (A)
+	ArrayPower     float32 `json:"ap"` // PV array rated power, (W)
+	BatteryVoltage float32 `json:"bv"` // Rated voltage to the battery, (V)
+	ChargeCurrent  float32 `json:"cc"` // Rated charging current to the battery, (A)
+	ChargePower    float32 `json:"cp"` // Rated charging power to the battery, (W)
+	LoadCurrent    float32 `json:"lc"` // Rated current of the load terminal, 0 without one, (A)
+}
+
+// ReadRatedData reads the rated data from the Tracer connected on specified
+// portName.
+func ReadRatedData(portName string, opts ...Option) (d RatedData, err error) {
+	err = withPort(portName, opts, func(port io.ReadWriter, cfg config) error {
+		d, err = readRatedData(port, cfg)
+		return err
+	})
+	return
+}
+
+func readRatedData(port io.ReadWriter, cfg config) (d RatedData, err error) {
+	regs, err := readRegisters(port, cfg, funcReadInputRegisters, regRatedArrayVoltage, regRatedLoadCurrent-regRatedArrayVoltage+1)
+	if err != nil {
+		return
+	}
+	reg := func(addr uint16) uint16 { return regs[addr-regRatedArrayVoltage] }
+	// Powers are two registers, the low word first.
+	reg32 := func(addr uint16) uint32 { return uint32(reg(addr+1))<<16 | uint32(reg(addr)) }
+	d.ArrayVoltage = float32(reg(regRatedArrayVoltage)) / 100
+	d.ArrayCurrent = float32(reg(regRatedArrayCurrent)) / 100
+	d.ArrayPower = float32(reg32(regRatedArrayPower)) / 100
+	d.BatteryVoltage = float32(reg(regRatedBatteryVoltage)) / 100
+	d.ChargeCurrent = float32(reg(regRatedChargeCurrent)) / 100
+	d.ChargePower = float32(reg32(regRatedChargePower)) / 100
+	d.LoadCurrent = float32(reg(regRatedLoadCurrent)) / 100
+	return
+}
+
+// ChargingMode is how the Tracer regulates charging.
+type ChargingMode int
+
+// Charging modes.
+const (
+	ChargingOnOff ChargingMode = iota // Charging is switched on and off
+	ChargingPWM                       // Pulse width modulation
+	ChargingMPPT                      // Maximum power point tracking
+)
+
+func (m ChargingMode) String() string {
+	switch m {
+	case ChargingOnOff:
+		return "on/off"
+	case ChargingPWM:
+		return "PWM"
+	case ChargingMPPT:
+		return "MPPT"
+	}
+	return "unknown"
+}
+
+// BatteryType is the battery type the Tracer is configured for.
+type BatteryType int
+
+// Battery types.
+const (
+	BatteryUserDefined BatteryType = iota // Voltages are set by the user
+	BatterySealed                         // Sealed lead acid
+	BatteryGel                            // Gel
+	BatteryFlooded                        // Flooded lead acid
+)
+
+func (b BatteryType) String() string {
+	switch b {
+	case BatteryUserDefined:
+		return "user defined"
+	case BatterySealed:
+		return "sealed"
+	case BatteryGel:
+		return "gel"
+	case BatteryFlooded:
+		return "flooded"
+	}
+	return "unknown"
+}
+
+// Rated battery voltages by the codes used by the Tracer, code 0 means the
+// voltage is recognized automatically.
+var ratedVoltages = []int{0, 12, 24, 36, 48, 60, 110, 120, 220, 240}
+
+// ControlSettings contain the settings of the Tracer that control how it charges
+// and discharges the battery.
+type ControlSettings struct {
+	ChargingMode          ChargingMode `json:"cmode"`    // How charging is regulated, fixed by model
+	BatteryType           BatteryType  `json:"btype"`    // Configured battery type
+	BatteryCapacity       int          `json:"bcap"`     // Battery capacity, (Ah)
+	BatteryRatedVoltage   int          `json:"bratedv"`  // System voltage, 0 if recognized automatically, (V)
+	SOCManagement         bool         `json:"socmgmt"`  // Charging and discharging is managed by SOC rather than voltage
+	ChargingPercentage    int          `json:"cpercent"` // Depth of charge, (%)
+	DischargingPercentage int          `json:"dpercent"` // Depth of discharge, (%)
+}
+
+// ReadControlSettings reads the charging and discharging control settings from
+// the Tracer connected on specified portName.
+func ReadControlSettings(portName string, opts ...Option) (s ControlSettings, err error) {
+	err = withPort(portName, opts, func(port io.ReadWriter, cfg config) error {
+		s, err = readControlSettings(port, cfg)
+		return err
+	})
+	return
+}
+
+func readControlSettings(port io.ReadWriter, cfg config) (s ControlSettings, err error) {
+	regs, err := readRegisters(port, cfg, funcReadInputRegisters, regChargingMode, 1)
+	if err != nil {
+		return
+	}
+	s.ChargingMode = ChargingMode(regs[0])
+
+	if regs, err = readRegisters(port, cfg, funcReadHoldingRegisters, regBatteryType, 2); err != nil {
+		return
+	}
+	s.BatteryType = BatteryType(regs[0])
+	s.BatteryCapacity = int(regs[1])
+
+	if regs, err = readRegisters(port, cfg, funcReadHoldingRegisters, regBatteryRatedVoltage, 1); err != nil {
+		return
+	}
+	if int(regs[0]) < len(ratedVoltages) {
+		s.BatteryRatedVoltage = ratedVoltages[regs[0]]
+	}
+
+	if regs, err = readRegisters(port, cfg, funcReadHoldingRegisters, regDischargingPercentage, 2); err != nil {
+		return
+	}
+	s.DischargingPercentage = int(regs[0])
+	s.ChargingPercentage = int(regs[1])
+
+	if regs, err = readRegisters(port, cfg, funcReadHoldingRegisters, regManagementMode, 1); err != nil {
+		return
+	}
+	s.SOCManagement = regs[0] == 1
+	return
+}
+
+// CapacityWh returns the battery capacity in Wh, the capacity in Ah times the
+// system voltage. It is 0 when the system voltage is recognized automatically
+// since the setting does not tell the voltage in use.
+func (s ControlSettings) CapacityWh() float32 {
+	return float32(s.BatteryCapacity * s.BatteryRatedVoltage)
+}
+
+// BatterySettings contain the configured battery voltage thresholds and the
+// temperature compensation of the charging voltages.
+//
+// These are the configured values. The Tracer does not expose the thresholds it
+// currently applies, so any compensation it makes, for example for temperature,
+// is not reflected here.
+type BatterySettings struct {
+	TempCompensation        float32 `json:"tcomp"`  // Temperature compensation coefficient, (mV/C/2V)
+	HighVoltageDisconnect   float32 `json:"hvd"`    // Charging is disconnected above this voltage, (V)
+	ChargingLimitVoltage    float32 `json:"clv"`    // Charging stops above this voltage, (V)
+	OverVoltageReconnect    float32 `json:"ovr"`    // Charging reconnects below this voltage after over voltage, (V)
+	EqualizationVoltage     float32 `json:"eqv"`    // Equalization charging voltage, (V)
+	BoostVoltage            float32 `json:"boostv"` // Boost charging voltage, (V)
+	FloatVoltage            float32 `json:"floatv"` // Float charging voltage, (V)
+	BoostReconnectVoltage   float32 `json:"brv"`    // Boost charging starts again below this voltage, (V)
+	LowVoltageReconnect     float32 `json:"lvr"`    // Load reconnects above this voltage after low voltage disconnect, (V)
+	UnderVoltageRecover     float32 `json:"uvr"`    // Under voltage warning clears above this voltage, (V)
+	UnderVoltageWarning     float32 `json:"uvw"`    // Under voltage warning below this voltage, (V)
+	LowVoltageDisconnect    float32 `json:"lvd"`    // Load is disconnected below this voltage, (V)
+	DischargingLimitVoltage float32 `json:"dlv"`    // Discharging stops below this voltage, (V)
+}
+
+// ReadBatterySettings reads the battery voltage thresholds and temperature
+// compensation from the Tracer connected on specified portName.
+func ReadBatterySettings(portName string, opts ...Option) (s BatterySettings, err error) {
+	err = withPort(portName, opts, func(port io.ReadWriter, cfg config) error {
+		s, err = readBatterySettings(port, cfg)
+		return err
+	})
+	return
+}
+
+func readBatterySettings(port io.ReadWriter, cfg config) (s BatterySettings, err error) {
+	regs, err := readRegisters(port, cfg, funcReadHoldingRegisters, regTempCompensation, 13)
+	if err != nil {
+		return
+	}
+	v := func(i int) float32 {
+		return float32(regs[i+1]) / 100
+	}
+	s = BatterySettings{
+		TempCompensation:        float32(regs[0]) / 100,
+		HighVoltageDisconnect:   v(0),
+		ChargingLimitVoltage:    v(1),
+		OverVoltageReconnect:    v(2),
+		EqualizationVoltage:     v(3),
+		BoostVoltage:            v(4),
+		FloatVoltage:            v(5),
+		BoostReconnectVoltage:   v(6),
+		LowVoltageReconnect:     v(7),
+		UnderVoltageRecover:     v(8),
+		UnderVoltageWarning:     v(9),
+		LowVoltageDisconnect:    v(10),
+		DischargingLimitVoltage: v(11),
+	}
+	return
+}
+
+// Registers returns the settings as the register values they are stored in,
+// starting with the temperature compensation at 0x9002 and followed by the
+// voltage thresholds in the order of the fields.
+func (s BatterySettings) Registers() []uint16 {
+	return []uint16{
+		RegisterValue(s.TempCompensation),
+		RegisterValue(s.HighVoltageDisconnect),
+		RegisterValue(s.ChargingLimitVoltage),
+		RegisterValue(s.OverVoltageReconnect),
+		RegisterValue(s.EqualizationVoltage),
+		RegisterValue(s.BoostVoltage),
+		RegisterValue(s.FloatVoltage),
+		RegisterValue(s.BoostReconnectVoltage),
+		RegisterValue(s.LowVoltageReconnect),
+		RegisterValue(s.UnderVoltageRecover),
+		RegisterValue(s.UnderVoltageWarning),
+		RegisterValue(s.LowVoltageDisconnect),
+		RegisterValue(s.DischargingLimitVoltage),
+	}
+}
+
+// SetOverVoltageThresholds writes the high voltage disconnect and over voltage
+// reconnect of BatterySettings to the Tracer connected on specified portName.
+// The disconnect voltage must be above the reconnect voltage, which must be above
+// the configured boost voltage, otherwise an error is returned and nothing is
+// written. The charging limit voltage, stored between the two, is written back
+// unchanged. Like the charging voltages, the Tracer only accepts thresholds of
+// its own when the battery type is BatteryUserDefined.
+func SetOverVoltageThresholds(portName string, disconnect, reconnect float32, opts ...Option) error {
+	if disconnect <= reconnect {
+		return fmt.Errorf("high voltage disconnect %.2f not above over voltage reconnect %.2f", disconnect, reconnect)
+	}
+	return withPort(portName, opts, func(port io.ReadWriter, cfg config) error {
+		s, err := readBatterySettings(port, cfg)
+		if err != nil {
+			return err
+		}
+		if reconnect <= s.BoostVoltage {
+			return fmt.Errorf("over voltage reconnect %.2f not above boost voltage %.2f", reconnect, s.BoostVoltage)
+		}
+		regs := []uint16{RegisterValue(disconnect), RegisterValue(s.ChargingLimitVoltage), RegisterValue(reconnect)}
+		return writeRegisters(port, cfg, regHighVoltageDisconnect, regs)
+	})
+}
+
+// Reference temperature of the temperature compensation, (C).
+const compensationReference = 25
+
+// Compensated returns the charging voltage v compensated for battery temperature
+// temp in a system with rated voltage systemVoltage, made up of 2 V cells. The
+// compensation is relative to 25 C, the voltage is raised when colder and lowered
+// when warmer.
+func (s BatterySettings) Compensated(v, temp, systemVoltage float32) float32 {
+	cells := systemVoltage / 2
+	return v - s.TempCompensation*(temp-compensationReference)*cells/1000
+}
+
+// ChargeTarget contain the charging voltages after temperature compensation.
+type ChargeTarget struct {
+	BatteryTemp         float32 `json:"btemp"`  // Battery temperature, (C)
+	SystemVoltage       float32 `json:"sysv"`   // Rated system voltage, (V)
+	EqualizationVoltage float32 `json:"eqv"`    // Compensated equalization charging voltage, (V)
+	BoostVoltage        float32 `json:"boostv"` // Compensated boost charging voltage, (V)
+	FloatVoltage        float32 `json:"floatv"` // Compensated float charging voltage, (V)
+}
+
+// ReadChargeTarget reads the battery settings, battery temperature and system
+// voltage from the Tracer connected on specified portName and calculates the
+// temperature compensated charging voltages. The Tracer does not expose the
+// voltages it is currently charging towards so they are calculated the way the
+// Tracer documents its compensation.
+func ReadChargeTarget(portName string, opts ...Option) (c ChargeTarget, err error) {
+	err = withPort(portName, opts, func(port io.ReadWriter, cfg config) error {
+		s, err := readBatterySettings(port, cfg)
+		if err != nil {
+			return err
+		}
+		regs, err := readRegisters(port, cfg, funcReadInputRegisters, regBatteryTemp, 1)
+		if err != nil {
+			return err
+		}
+		c.BatteryTemp = float32(int16(regs[0])) / 100
+		if regs, err = readRegisters(port, cfg, funcReadInputRegisters, regSystemRatedVoltage, 1); err != nil {
+			return err
+		}
+		c.SystemVoltage = float32(regs[0]) / 100
+
+		c.EqualizationVoltage = s.Compensated(s.EqualizationVoltage, c.BatteryTemp, c.SystemVoltage)
+		c.BoostVoltage = s.Compensated(s.BoostVoltage, c.BatteryTemp, c.SystemVoltage)
+		c.FloatVoltage = s.Compensated(s.FloatVoltage, c.BatteryTemp, c.SystemVoltage)
+		return nil
+	})
+	return
+}
+
+// ChargeDurations contain how long the Tracer stays in the boost and
+// equalization charging stages and how often it equalizes.
+type ChargeDurations struct {
+	EqualizationDuration time.Duration `json:"eqdur"`    // Time spent equalizing, whole minutes
+	BoostDuration        time.Duration `json:"boostdur"` // Time spent boost charging, whole minutes
+	EqualizationInterval int           `json:"eqint"`    // Days between equalization charges
+}
+
+// ReadChargeDurations reads the charging stage durations from the Tracer
+// connected on specified portName.
+func ReadChargeDurations(portName string, opts ...Option) (d ChargeDurations, err error) {
+	err = withPort(portName, opts, func(port io.ReadWriter, cfg config) error {
+		d, err = readChargeDurations(port, cfg)
+		return err
+	})
+	return
+}
+
+func readChargeDurations(port io.ReadWriter, cfg config) (d ChargeDurations, err error) {
+	regs, err := readRegisters(port, cfg, funcReadHoldingRegisters, regEqualizationDuration, 2)
+	if err != nil {
+		return
+	}
+	d.EqualizationDuration = time.Duration(regs[0]) * time.Minute
+	d.BoostDuration = time.Duration(regs[regBoostDuration-regEqualizationDuration]) * time.Minute
+
+	if regs, err = readRegisters(port, cfg, funcReadHoldingRegisters, regEqualizationInterval, 1); err != nil {
+		return
+	}
+	d.EqualizationInterval = int(regs[0])
+	return
+}
+
+// SetChargeDurations writes the charging stage durations to the Tracer connected
+// on specified portName. Durations are rounded down to whole minutes. The Tracer
+// answers with an exception for values outside the range it accepts.
+func SetChargeDurations(portName string, d ChargeDurations, opts ...Option) error {
+	if err := checkChargeDurations(d); err != nil {
+		return err
+	}
+	return withPort(portName, opts, func(port io.ReadWriter, cfg config) error {
+		return writeChargeDurations(port, cfg, d)
+	})
+}
+
+// Returns an error if d does not fit in the registers.
+func checkChargeDurations(d ChargeDurations) error {
+	eq, boost := d.EqualizationDuration/time.Minute, d.BoostDuration/time.Minute
+	if eq < 0 || eq > 0xffff || boost < 0 || boost > 0xffff {
+		return fmt.Errorf("charging duration out of range")
+	}
+	if d.EqualizationInterval < 0 || d.EqualizationInterval > 0xffff {
+		return fmt.Errorf("equalization interval %d out of range", d.EqualizationInterval)
+	}
+	return nil
+}
+
+func writeChargeDurations(port io.ReadWriter, cfg config, d ChargeDurations) error {
+	eq, boost := d.EqualizationDuration/time.Minute, d.BoostDuration/time.Minute
+	if err := writeRegisters(port, cfg, regEqualizationDuration, []uint16{uint16(eq), uint16(boost)}); err != nil {
+		return err
+	}
+	return writeRegisters(port, cfg, regEqualizationInterval, []uint16{uint16(d.EqualizationInterval)})
+}
+
+// DayNightSettings contain how the Tracer tells day from night by the array
+// voltage, which drives the light and timer load modes. It is night once the
+// array voltage has stayed below NightThresholdVoltage for NightDelay and day once
+// it has stayed above DayThresholdVoltage for DayDelay.
+type DayNightSettings struct {
+	NightThresholdVoltage float32       `json:"nttv"`   // Array voltage below which it is night, (V)
+	NightDelay            time.Duration `json:"ndelay"` // Time below the threshold before it is night, whole minutes
+	DayThresholdVoltage   float32       `json:"dttv"`   // Array voltage above which it is day, (V)
+	DayDelay              time.Duration `json:"ddelay"` // Time above the threshold before it is day, whole minutes
+}
+
+// ReadDayNightSettings reads the day and night detection settings from the
+// Tracer connected on specified portName.
+func ReadDayNightSettings(portName string, opts ...Option) (s DayNightSettings, err error) {
+	err = withPort(portName, opts, func(port io.ReadWriter, cfg config) error {
+		s, err = readDayNightSettings(port, cfg)
+		return err
+	})
+	return
+}
+
+func readDayNightSettings(port io.ReadWriter, cfg config) (s DayNightSettings, err error) {
+	regs, err := readRegisters(port, cfg, funcReadHoldingRegisters, regNightThresholdVoltage, 4)
+	if err != nil {
+		return
+	}
+	s.NightThresholdVoltage = float32(regs[0]) / 100
+	s.NightDelay = time.Duration(regs[regNightDelay-regNightThresholdVoltage]) * time.Minute
+	s.DayThresholdVoltage = float32(regs[regDayThresholdVoltage-regNightThresholdVoltage]) / 100
+	s.DayDelay = time.Duration(regs[regDayDelay-regNightThresholdVoltage]) * time.Minute
+	return
+}
+
+// SetDayNightSettings writes the day and night detection settings to the Tracer
+// connected on specified portName. The day threshold must be above the night
+// threshold. Delays are rounded down to whole minutes.
+func SetDayNightSettings(portName string, s DayNightSettings, opts ...Option) error {
+	if s.DayThresholdVoltage <= s.NightThresholdVoltage {
+		return fmt.Errorf("day threshold voltage %.2f not above night threshold voltage %.2f", s.DayThresholdVoltage, s.NightThresholdVoltage)
+	}
+	night, day := s.NightDelay/time.Minute, s.DayDelay/time.Minute
+	if night < 0 || night > 0xffff || day < 0 || day > 0xffff {
+		return fmt.Errorf("day or night delay out of range")
+	}
+	regs := []uint16{RegisterValue(s.NightThresholdVoltage), uint16(night), RegisterValue(s.DayThresholdVoltage), uint16(day)}
+	return withPort(portName, opts, func(port io.ReadWriter, cfg config) error {
+		return writeRegisters(port, cfg, regNightThresholdVoltage, regs)
+	})
+}
+
+// SetBacklightTime sets how long the display backlight of the Tracer connected on
+// specified portName stays on after a button press. The time is rounded down to
+// whole seconds.
+func SetBacklightTime(portName string, d time.Duration, opts ...Option) error {
+	sec := d / time.Second
+	if sec < 0 || sec > 0xffff {
+		return fmt.Errorf("backlight time %v out of range", d)
+	}
+	return withPort(portName, opts, func(port io.ReadWriter, cfg config) error {
+		return writeRegisters(port, cfg, regBacklightTime, []uint16{uint16(sec)})
+	})
+}
+
+// SetBuzzer turns the alarm buzzer of the Tracer connected on specified portName
+// on or off.
+//
+// The BN series has no register controlling the buzzer, so ErrNotSupported is
+// always returned and nothing is changed.
+func SetBuzzer(portName string, on bool, opts ...Option) error {
+	return ErrNotSupported
+}
+
+// EqualizationSettings contain the equalization charging voltage and how often
+// the Tracer equalizes.
+type EqualizationSettings struct {
+	Voltage  float32 `json:"eqv"`   // Equalization charging voltage, (V)
+	Interval int     `json:"eqint"` // Days between equalization charges
+}
+
+// ReadEqualizationSettings reads the equalization settings from the Tracer
+// connected on specified portName.
+func ReadEqualizationSettings(portName string, opts ...Option) (s EqualizationSettings, err error) {
+	err = withPort(portName, opts, func(port io.ReadWriter, cfg config) error {
+		regs, err := readRegisters(port, cfg, funcReadHoldingRegisters, regEqualizationVoltage, 1)
+		if err != nil {
+			return err
+		}
+		s.Voltage = float32(regs[0]) / 100
+
+		if regs, err = readRegisters(port, cfg, funcReadHoldingRegisters, regEqualizationInterval, 1); err != nil {
+			return err
+		}
+		s.Interval = int(regs[0])
+		return nil
+	})
+	return
+}
+
+// SetEqualizationSettings writes the equalization settings to the Tracer
+// connected on specified portName. The Tracer only accepts a voltage of its own
+// when the battery type is BatteryUserDefined, the other types have fixed
+// charging voltages.
+func SetEqualizationSettings(portName string, s EqualizationSettings, opts ...Option) error {
+	if s.Interval < 0 || s.Interval > 0xffff {
+		return fmt.Errorf("equalization interval %d out of range", s.Interval)
+	}
+	return withPort(portName, opts, func(port io.ReadWriter, cfg config) error {
+		if err := writeRegisters(port, cfg, regEqualizationVoltage, []uint16{RegisterValue(s.Voltage)}); err != nil {
+			return err
+		}
+		return writeRegisters(port, cfg, regEqualizationInterval, []uint16{uint16(s.Interval)})
+	})
+}
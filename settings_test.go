@@ -0,0 +1,116 @@
+// Copyright (c) 2015, Roland Bali (roland.bali@spagettikod.se), Spagettikod
+// All rights reserved.
+//
+// Redistribution and use in source and binary forms, with or without modification,
+// are permitted provided that the following conditions are met:
+//
+// 1. Redistributions of source code must retain the above copyright notice, this
+//    list of conditions and the following disclaimer.
+//
+// 2. Redistributions in binary form must reproduce the above copyright notice, this
+//    list of conditions and the following disclaimer in the documentation and/or
+//    other materials provided with the distribution.
+//
+// 3. Neither the name of the copyright holder nor the names of its contributors may
+//    be used to endorse or promote products derived from this software without
+//    specific prior written permission.
+//
+// THIS SOFTWARE IS PROVIDED BY THE COPYRIGHT HOLDERS AND CONTRIBUTORS "AS IS" AND
+// ANY EXPRESS OR IMPLIED WARRANTIES, INCLUDING, BUT NOT LIMITED TO, THE IMPLIED
+// WARRANTIES OF MERCHANTABILITY AND FITNESS FOR A PARTICULAR PURPOSE ARE DISCLAIMED.
+// IN NO EVENT SHALL THE COPYRIGHT HOLDER OR CONTRIBUTORS BE LIABLE FOR ANY DIRECT,
+// INDIRECT, INCIDENTAL, SPECIAL, EXEMPLARY, OR CONSEQUENTIAL DAMAGES (INCLUDING, BUT
+// NOT LIMITED TO, PROCUREMENT OF SUBSTITUTE GOODS OR SERVICES; LOSS OF USE, DATA, OR
+// PROFITS; OR BUSINESS INTERRUPTION) HOWEVER CAUSED AND ON ANY THEORY OF LIABILITY,
+// WHETHER IN CONTRACT, STRICT LIABILITY, OR TORT (INCLUDING NEGLIGENCE OR OTHERWISE)
+// ARISING IN ANY WAY OUT OF THE USE OF THIS SOFTWARE, EVEN IF ADVISED OF THE
+// POSSIBILITY OF SUCH DAMAGE.
+
+package gotracer
+
+import (
+	"bytes"
+	"testing"
+	"time"
+)
+
+func TestWriteChargeDurationsFrame(t *testing.T) {
+	f := newFakeTracer()
+	tr := f.tracer()
+	d := ChargeDurations{EqualizationDuration: 120 * time.Minute, BoostDuration: 90 * time.Minute, EqualizationInterval: 30}
+	if err := writeChargeDurations(f, tr.cfg, d); err != nil {
+		t.Fatal(err)
+	}
+	reqs := f.requestsOf(funcWriteRegisters)
+	if len(reqs) != 2 {
+		t.Fatalf("got %d write requests, want 2", len(reqs))
+	}
+	// Equalize duration 0x906b and boost duration 0x906c.
+	want := []byte{0x01, 0x10, 0x90, 0x6b, 0x00, 0x02, 0x04, 0x00, 0x78, 0x00, 0x5a, 0x18, 0x10}
+	if !bytes.Equal(reqs[0], want) {
+		t.Errorf("durations request % x, want % x", reqs[0], want)
+	}
+	if f.holding[0x906a] != 0 {
+		t.Errorf("default load setting overwritten with %d", f.holding[0x906a])
+	}
+}
+
+func TestReadChargeDurationsFrame(t *testing.T) {
+	f := newFakeTracer()
+	tr := f.tracer()
+	f.holding[0x906a] = 1
+	f.holding[0x906b] = 120
+	f.holding[0x906c] = 90
+	d, err := readChargeDurations(f, tr.cfg)
+	if err != nil {
+		t.Fatal(err)
+	}
+	want := []byte{0x01, 0x03, 0x90, 0x6b, 0x00, 0x02, 0x98, 0xd7}
+	if reqs := f.requestsOf(funcReadHoldingRegisters); len(reqs) == 0 || !bytes.Equal(reqs[0], want) {
+		t.Errorf("durations request % x, want % x", reqs, want)
+	}
+	if d.EqualizationDuration != 120*time.Minute || d.BoostDuration != 90*time.Minute {
+		t.Errorf("read equalization %v and boost %v, want 2h and 1h30m", d.EqualizationDuration, d.BoostDuration)
+	}
+}
+
+func TestReadRatedData(t *testing.T) {
+	f := newFakeTracer()
+	tr := f.tracer()
+	f.input[0x3000] = 15000
+	f.input[0x3002], f.input[0x3003] = 0xeb10, 0x0009 // 6500.00 W, low word first
+	f.input[0x3004] = 2400
+	f.input[0x300e] = 2000
+	d, err := readRatedData(f, tr.cfg)
+	if err != nil {
+		t.Fatal(err)
+	}
+	want := RatedData{ArrayVoltage: 150, ArrayPower: 6500, BatteryVoltage: 24, LoadCurrent: 20}
+	if d != want {
+		t.Errorf("got %+v, want %+v", d, want)
+	}
+}
+
+func TestReadControlSettingsAddresses(t *testing.T) {
+	f := newFakeTracer()
+	tr := f.tracer()
+	f.holding[0x9067] = 2  // 24 V
+	f.holding[0x906d] = 30 // Depth of discharge
+	f.holding[0x906e] = 90 // Depth of charge
+	s, err := readControlSettings(f, tr.cfg)
+	if err != nil {
+		t.Fatal(err)
+	}
+	requested := map[uint16]int{}
+	for _, r := range f.requestsOf(funcReadHoldingRegisters) {
+		requested[uint16(r[2])<<8|uint16(r[3])] = int(r[4])<<8 | int(r[5])
+	}
+	for addr, count := range map[uint16]int{0x9067: 1, 0x906d: 2} {
+		if requested[addr] != count {
+			t.Errorf("read %d registers at %#04x, want %d", requested[addr], addr, count)
+		}
+	}
+	if s.BatteryRatedVoltage != 24 || s.DischargingPercentage != 30 || s.ChargingPercentage != 90 {
+		t.Errorf("read rated voltage %d, discharging %d%% and charging %d%%, want 24, 30%% and 90%%", s.BatteryRatedVoltage, s.DischargingPercentage, s.ChargingPercentage)
+	}
+}
@@ -0,0 +1,114 @@
+// Copyright (c) 2015, Roland Bali (roland.bali@spagettikod.se), Spagettikod
+// All rights reserved.
+//
+// Redistribution and use in source and binary forms, with or without modification,
+// are permitted provided that the following conditions are met:
+//
+// 1. Redistributions of source code must retain the above copyright notice, this
+//    list of conditions and the following disclaimer.
+//
+// 2. Redistributions in binary form must reproduce the above copyright notice, this
+//    list of conditions and the following disclaimer in the documentation and/or
+//    other materials provided with the distribution.
+//
+// 3. Neither the name of the copyright holder nor the names of its contributors may
+//    be used to endorse or promote products derived from this software without
+//    specific prior written permission.
+//
+// THIS SOFTWARE IS PROVIDED BY THE COPYRIGHT HOLDERS AND CONTRIBUTORS "AS IS" AND
+// ANY EXPRESS OR IMPLIED WARRANTIES, INCLUDING, BUT NOT LIMITED TO, THE IMPLIED
+// WARRANTIES OF MERCHANTABILITY AND FITNESS FOR A PARTICULAR PURPOSE ARE DISCLAIMED.
+// IN NO EVENT SHALL THE COPYRIGHT HOLDER OR CONTRIBUTORS BE LIABLE FOR ANY DIRECT,
+// INDIRECT, INCIDENTAL, SPECIAL, EXEMPLARY, OR CONSEQUENTIAL DAMAGES (INCLUDING, BUT
+// NOT LIMITED TO, PROCUREMENT OF SUBSTITUTE GOODS OR SERVICES; LOSS OF USE, DATA, OR
+// PROFITS; OR BUSINESS INTERRUPTION) HOWEVER CAUSED AND ON ANY THEORY OF LIABILITY,
+// WHETHER IN CONTRACT, STRICT LIABILITY, OR TORT (INCLUDING NEGLIGENCE OR OTHERWISE)
+// ARISING IN ANY WAY OUT OF THE USE OF THIS SOFTWARE, EVEN IF ADVISED OF THE
+// POSSIBILITY OF SUCH DAMAGE.
+
+package gotracer
+
+import (
+	"io"
+	"time"
+)
+
+// Snapshot contain everything readable from a Tracer, for archiving the state of
+// the controller, for example before and after changing its settings.
+type Snapshot struct {
+	Device          DeviceInfo       `json:"device"`
+	Rated           RatedData        `json:"rated"`
+	Status          TracerStatus     `json:"status"`
+	Faults          Faults           `json:"faults"`
+	Array           ArraySettings    `json:"array"`
+	Control         ControlSettings  `json:"control"`
+	Battery         BatterySettings  `json:"battery"`
+	ChargeDurations ChargeDurations  `json:"durations"`
+	DayNight        DayNightSettings `json:"daynight"`
+	Clock           time.Time        `json:"clock"` // Time of the device clock
+}
+
+// DeviceInfo describe the connected Tracer. The BN series holds no model name or
+// firmware version in any documented register, the profile is the one
+// DetectProfile would return.
+type DeviceInfo struct {
+	Profile       string  `json:"profile"` // Name of the detected profile
+	HasLoad       bool    `json:"hasload"` // True if the controller has a load terminal
+	SystemVoltage float32 `json:"sysv"`    // Rated voltage of the system currently in use, (V)
+}
+
+// Faults contain the fault and state flags of the battery and of the charging
+// equipment, taken from the status of the same snapshot.
+type Faults struct {
+	Battery  BatteryStatus  `json:"battery"`
+	Charging ChargingFaults `json:"charging"`
+}
+
+// FullSnapshot reads the device info, rated data, status, all settings and the
+// clock of the Tracer connected on specified portName. Everything is read with
+// the port opened once, and the first error stops the snapshot.
+func FullSnapshot(portName string, opts ...Option) (s Snapshot, err error) {
+	err = withPort(portName, opts, func(port io.ReadWriter, cfg config) error {
+		if s.Rated, err = readRatedData(port, cfg); err != nil {
+			return err
+		}
+		p := ProfileBN
+		if s.Rated.LoadCurrent == 0 {
+			p = ProfileNoLoad
+		}
+		s.Device.Profile, s.Device.HasLoad = p.Name, p.HasLoad
+		regs, err := readRegisters(port, cfg, funcReadInputRegisters, regSystemRatedVoltage, 1)
+		if err != nil {
+			return err
+		}
+		s.Device.SystemVoltage = float32(regs[0]) / 100
+
+		r, err := readStatus(port, cfg, queryStateCommand)
+		if err != nil {
+			return err
+		}
+		if s.Status, err = cfg.decoded(r.Scaled()); err != nil {
+			return err
+		}
+		s.Faults = Faults{Battery: s.Status.BatteryStatus, Charging: s.Status.ChargingFaults}
+
+		if s.Array, err = readArraySettings(port, cfg); err != nil {
+			return err
+		}
+		if s.Control, err = readControlSettings(port, cfg); err != nil {
+			return err
+		}
+		if s.Battery, err = readBatterySettings(port, cfg); err != nil {
+			return err
+		}
+		if s.ChargeDurations, err = readChargeDurations(port, cfg); err != nil {
+			return err
+		}
+		if s.DayNight, err = readDayNightSettings(port, cfg); err != nil {
+			return err
+		}
+		s.Clock, err = readClock(port, cfg)
+		return err
+	})
+	return
+}
@@ -0,0 +1,100 @@
+// Copyright (c) 2015, Roland Bali (roland.bali@spagettikod.se), Spagettikod
+// All rights reserved.
+//
+// Redistribution and use in source and binary forms, with or without modification,
+// are permitted provided that the following conditions are met:
+//
+// 1. Redistributions of source code must retain the above copyright notice, this
+//    list of conditions and the following disclaimer.
+//
+// 2. Redistributions in binary form must reproduce the above copyright notice, this
+//    list of conditions and the following disclaimer in the documentation and/or
+//    other materials provided with the distribution.
+//
+// 3. Neither the name of the copyright holder nor the names of its contributors may
+//    be used to endorse or promote products derived from this software without
+//    specific prior written permission.
+//
+// THIS SOFTWARE IS PROVIDED BY THE COPYRIGHT HOLDERS AND CONTRIBUTORS "AS IS" AND
+// ANY EXPRESS OR IMPLIED WARRANTIES, INCLUDING, BUT NOT LIMITED TO, THE IMPLIED
+// WARRANTIES OF MERCHANTABILITY AND FITNESS FOR A PARTICULAR PURPOSE ARE DISCLAIMED.
+// IN NO EVENT SHALL THE COPYRIGHT HOLDER OR CONTRIBUTORS BE LIABLE FOR ANY DIRECT,
+// INDIRECT, INCIDENTAL, SPECIAL, EXEMPLARY, OR CONSEQUENTIAL DAMAGES (INCLUDING, BUT
+// NOT LIMITED TO, PROCUREMENT OF SUBSTITUTE GOODS OR SERVICES; LOSS OF USE, DATA, OR
+// PROFITS; OR BUSINESS INTERRUPTION) HOWEVER CAUSED AND ON ANY THEORY OF LIABILITY,
+// WHETHER IN CONTRACT, STRICT LIABILITY, OR TORT (INCLUDING NEGLIGENCE OR OTHERWISE)
+// ARISING IN ANY WAY OUT OF THE USE OF THIS SOFTWARE, EVEN IF ADVISED OF THE
+// POSSIBILITY OF SUCH DAMAGE.
+
+package gotracer
+
+import (
+	"io"
+	"time"
+)
+
+// Coil clearing the energy statistics.
+const coilClearEnergy = 0x0014
+
+// ReadUptime reads the accumulated running time of the Tracer connected on
+// specified portName.
+//
+// The BN series does not keep track of its running time in any register known
+// to be readable, so ErrNotSupported is always returned for now.
+func ReadUptime(portName string, opts ...Option) (time.Duration, error) {
+	return 0, ErrNotSupported
+}
+
+// BatteryCounters contain how many times the battery has been fully charged and
+// over discharged.
+type BatteryCounters struct {
+	FullCharges    int `json:"fullcharges"` // Number of times the battery was fully charged
+	OverDischarges int `json:"overdis"`     // Number of over discharges
+}
+
+// ReadBatteryCounters reads the full charge and over discharge counts of the
+// Tracer connected on specified portName.
+//
+// The statistical registers of the BN series hold the daily extremes and energy
+// counters but no such counts, so ErrNotSupported is always returned for now.
+func ReadBatteryCounters(portName string, opts ...Option) (BatteryCounters, error) {
+	return BatteryCounters{}, ErrNotSupported
+}
+
+// ResetDailyExtremes resets the daily maximum and minimum battery voltage of the
+// Tracer connected on specified portName.
+//
+// The Tracer resets BatteryMaxVoltage and BatteryMinVoltage itself when its
+// clock passes midnight, together with the daily energy counters, see ReadClock
+// for the time of the device. The BN series has no command resetting them on
+// demand, so ErrNotSupported is always returned for now.
+func ResetDailyExtremes(portName string, opts ...Option) error {
+	return ErrNotSupported
+}
+
+// ClearEnergy clears the generated and consumed energy counters, daily, monthly,
+// annual and total, of the Tracer connected on specified portName. The BN series
+// clears all of them with a single coil, see ClearGeneratedEnergy.
+func ClearEnergy(portName string, opts ...Option) error {
+	return withPort(portName, opts, func(port io.ReadWriter, cfg config) error {
+		return writeCoil(port, cfg, coilClearEnergy, true)
+	})
+}
+
+// ClearGeneratedEnergy clears only the generated energy counters of the Tracer
+// connected on specified portName.
+//
+// The BN series clears the generated and consumed energy counters together, so
+// ErrNotSupported is always returned and nothing is cleared. Use ClearEnergy to
+// clear all counters.
+func ClearGeneratedEnergy(portName string, opts ...Option) error {
+	return ErrNotSupported
+}
+
+// ClearConsumedEnergy clears only the consumed energy counters of the Tracer
+// connected on specified portName.
+//
+// Like ClearGeneratedEnergy it always returns ErrNotSupported.
+func ClearConsumedEnergy(portName string, opts ...Option) error {
+	return ErrNotSupported
+}
@@ -0,0 +1,220 @@
+// Copyright (c) 2015, Roland Bali (roland.bali@spagettikod.se), Spagettikod
+// All rights reserved.
+//
+// Redistribution and use in source and binary forms, with or without modification,
+// are permitted provided that the following conditions are met:
+//
+// 1. Redistributions of source code must retain the above copyright notice, this
+//    list of conditions and the following disclaimer.
+//
+// 2. Redistributions in binary form must reproduce the above copyright notice, this
+//    list of conditions and the following disclaimer in the documentation and/or
+//    other materials provided with the distribution.
+//
+// 3. Neither the name of the copyright holder nor the names of its contributors may
+//    be used to endorse or promote products derived from this software without
+//    specific prior written permission.
+//
+// THIS SOFTWARE IS PROVIDED BY THE COPYRIGHT HOLDERS AND CONTRIBUTORS "AS IS" AND
+// ANY EXPRESS OR IMPLIED WARRANTIES, INCLUDING, BUT NOT LIMITED TO, THE IMPLIED
+// WARRANTIES OF MERCHANTABILITY AND FITNESS FOR A PARTICULAR PURPOSE ARE DISCLAIMED.
+// IN NO EVENT SHALL THE COPYRIGHT HOLDER OR CONTRIBUTORS BE LIABLE FOR ANY DIRECT,
+// INDIRECT, INCIDENTAL, SPECIAL, EXEMPLARY, OR CONSEQUENTIAL DAMAGES (INCLUDING, BUT
+// NOT LIMITED TO, PROCUREMENT OF SUBSTITUTE GOODS OR SERVICES; LOSS OF USE, DATA, OR
+// PROFITS; OR BUSINESS INTERRUPTION) HOWEVER CAUSED AND ON ANY THEORY OF LIABILITY,
+// WHETHER IN CONTRACT, STRICT LIABILITY, OR TORT (INCLUDING NEGLIGENCE OR OTHERWISE)
+// ARISING IN ANY WAY OUT OF THE USE OF THIS SOFTWARE, EVEN IF ADVISED OF THE
+// POSSIBILITY OF SUCH DAMAGE.
+
+package gotracer
+
+import "strings"
+
+// BatteryVoltageState is the voltage state of the battery as reported by the Tracer.
+type BatteryVoltageState int
+
+// Battery voltage states.
+const (
+	BatteryVoltageNormal        BatteryVoltageState = iota // Voltage is normal
+	BatteryOverVoltage                                     // Voltage is too high
+	BatteryUnderVoltage                                    // Voltage is below the under voltage warning level
+	BatteryLowVoltageDisconnect                            // Voltage is so low that the load is disconnected
+	BatteryVoltageFault                                    // Voltage is faulty
+)
+
+func (s BatteryVoltageState) String() string {
+	switch s {
+	case BatteryVoltageNormal:
+		return "normal voltage"
+	case BatteryOverVoltage:
+		return "over voltage"
+	case BatteryUnderVoltage:
+		return "under voltage"
+	case BatteryLowVoltageDisconnect:
+		return "low voltage disconnect"
+	case BatteryVoltageFault:
+		return "voltage fault"
+	}
+	return "unknown voltage state"
+}
+
+// BatteryTempState is the temperature state of the battery as reported by the Tracer.
+type BatteryTempState int
+
+// Battery temperature states.
+const (
+	BatteryTempNormal BatteryTempState = iota // Temperature is normal
+	BatteryOverTemp                           // Temperature is above the warning limit
+	BatteryLowTemp                            // Temperature is below the warning limit
+)
+
+func (s BatteryTempState) String() string {
+	switch s {
+	case BatteryTempNormal:
+		return "normal temperature"
+	case BatteryOverTemp:
+		return "over temperature"
+	case BatteryLowTemp:
+		return "low temperature"
+	}
+	return "unknown temperature state"
+}
+
+// BatteryStatus is the decoded battery status register.
+type BatteryStatus struct {
+	VoltageState       BatteryVoltageState `json:"vs"`  // Battery voltage state
+	TempState          BatteryTempState    `json:"ts"`  // Battery temperature state
+	AbnormalResistance bool                `json:"res"` // Battery internal resistance is abnormal, the resistance itself is not available
+	WrongRatedVoltage  bool                `json:"wrv"` // Rated voltage of the battery was wrongly identified
+}
+
+// Decodes the battery status register.
+func decodeBatteryStatus(reg uint16) BatteryStatus {
+	return BatteryStatus{
+		VoltageState:       BatteryVoltageState(reg & 0x000f),
+		TempState:          BatteryTempState(reg >> 4 & 0x000f),
+		AbnormalResistance: reg&(1<<8) != 0,
+		WrongRatedVoltage:  reg&(1<<15) != 0,
+	}
+}
+
+// Formatted output listing the battery states.
+func (s BatteryStatus) String() string {
+	states := []string{s.VoltageState.String(), s.TempState.String()}
+	if s.AbnormalResistance {
+		states = append(states, "abnormal internal resistance")
+	}
+	if s.WrongRatedVoltage {
+		states = append(states, "wrong rated voltage")
+	}
+	return strings.Join(states, ", ")
+}
+
+// ChargingFaults contain the hardware fault flags of the charging equipment
+// status register.
+type ChargingFaults struct {
+	Fault                    bool `json:"fault"`   // Charging equipment reports a fault
+	ArrayShort               bool `json:"pvshort"` // Solar panel input is short circuited
+	LoadMOSFETShort          bool `json:"lmos"`    // Load MOSFET is short circuited
+	LoadShort                bool `json:"lshort"`  // Load is short circuited
+	LoadOverCurrent          bool `json:"loc"`     // Load is over current
+	InputOverCurrent         bool `json:"ioc"`     // Solar panel input is over current
+	AntiReverseMOSFETShort   bool `json:"armos"`   // Anti-reverse MOSFET is short circuited
+	ChargingAntiReverseShort bool `json:"carmos"`  // Charging or anti-reverse MOSFET is short circuited
+	ChargingMOSFETShort      bool `json:"cmos"`    // Charging MOSFET is short circuited
+}
+
+// Decodes the fault bits of the charging equipment status register.
+func decodeChargingFaults(reg uint16) ChargingFaults {
+	bit := func(n uint) bool {
+		return reg&(1<<n) != 0
+	}
+	return ChargingFaults{
+		Fault:                    bit(1),
+		ArrayShort:               bit(4),
+		LoadMOSFETShort:          bit(7),
+		LoadShort:                bit(8),
+		LoadOverCurrent:          bit(9),
+		InputOverCurrent:         bit(10),
+		AntiReverseMOSFETShort:   bit(11),
+		ChargingAntiReverseShort: bit(12),
+		ChargingMOSFETShort:      bit(13),
+	}
+}
+
+// Encodes the faults as the bits of the charging equipment status register.
+func encodeChargingFaults(f ChargingFaults) uint16 {
+	var reg uint16
+	for _, v := range []struct {
+		set bool
+		bit uint
+	}{
+		{f.Fault, 1},
+		{f.ArrayShort, 4},
+		{f.LoadMOSFETShort, 7},
+		{f.LoadShort, 8},
+		{f.LoadOverCurrent, 9},
+		{f.InputOverCurrent, 10},
+		{f.AntiReverseMOSFETShort, 11},
+		{f.ChargingAntiReverseShort, 12},
+		{f.ChargingMOSFETShort, 13},
+	} {
+		if v.set {
+			reg |= 1 << v.bit
+		}
+	}
+	return reg
+}
+
+// Formatted output listing the faults.
+func (f ChargingFaults) String() string {
+	var faults []string
+	for _, v := range []struct {
+		set  bool
+		name string
+	}{
+		{f.Fault, "fault"},
+		{f.ArrayShort, "array short circuit"},
+		{f.LoadMOSFETShort, "load MOSFET short circuit"},
+		{f.LoadShort, "load short circuit"},
+		{f.LoadOverCurrent, "load over current"},
+		{f.InputOverCurrent, "input over current"},
+		{f.AntiReverseMOSFETShort, "anti-reverse MOSFET short circuit"},
+		{f.ChargingAntiReverseShort, "charging or anti-reverse MOSFET short circuit"},
+		{f.ChargingMOSFETShort, "charging MOSFET short circuit"},
+	} {
+		if v.set {
+			faults = append(faults, v.name)
+		}
+	}
+	if len(faults) == 0 {
+		return "no faults"
+	}
+	return strings.Join(faults, ", ")
+}
+
+// LoadState tells whether the load is on, and if not the reason it is off.
+type LoadState int
+
+// Load states.
+const (
+	LoadUnknown       LoadState = iota // State is not known, for example without a load terminal
+	LoadOn                             // Load is on
+	LoadOffManual                      // Load was turned off manually
+	LoadOffProtection                  // Load was turned off to protect the battery or the controller
+	LoadOffTimer                       // Load was turned off by the light or timer control
+)
+
+func (s LoadState) String() string {
+	switch s {
+	case LoadOn:
+		return "on"
+	case LoadOffManual:
+		return "off manually"
+	case LoadOffProtection:
+		return "off by protection"
+	case LoadOffTimer:
+		return "off by light or timer control"
+	}
+	return "unknown"
+}
@@ -0,0 +1,318 @@
+// Copyright (c) 2015, Roland Bali (roland.bali@spagettikod.se), Spagettikod
+// All rights reserved.
+//
+// Redistribution and use in source and binary forms, with or without modification,
+// are permitted provided that the following conditions are met:
+//
+// 1. Redistributions of source code must retain the above copyright notice, this
+//    list of conditions and the following disclaimer.
+//
+// 2. Redistributions in binary form must reproduce the above copyright notice, this
+//    list of conditions and the following disclaimer in the documentation and/or
+//    other materials provided with the distribution.
+//
+// 3. Neither the name of the copyright holder nor the names of its contributors may
+//    be used to endorse or promote products derived from this software without
+//    specific prior written permission.
+//
+// THIS SOFTWARE IS PROVIDED BY THE COPYRIGHT HOLDERS AND CONTRIBUTORS "AS IS" AND
+// ANY EXPRESS OR IMPLIED WARRANTIES, INCLUDING, BUT NOT LIMITED TO, THE IMPLIED
+// WARRANTIES OF MERCHANTABILITY AND FITNESS FOR A PARTICULAR PURPOSE ARE DISCLAIMED.
+// IN NO EVENT SHALL THE COPYRIGHT HOLDER OR CONTRIBUTORS BE LIABLE FOR ANY DIRECT,
+// INDIRECT, INCIDENTAL, SPECIAL, EXEMPLARY, OR CONSEQUENTIAL DAMAGES (INCLUDING, BUT
+// NOT LIMITED TO, PROCUREMENT OF SUBSTITUTE GOODS OR SERVICES; LOSS OF USE, DATA, OR
+// PROFITS; OR BUSINESS INTERRUPTION) HOWEVER CAUSED AND ON ANY THEORY OF LIABILITY,
+// WHETHER IN CONTRACT, STRICT LIABILITY, OR TORT (INCLUDING NEGLIGENCE OR OTHERWISE)
+// ARISING IN ANY WAY OUT OF THE USE OF THIS SOFTWARE, EVEN IF ADVISED OF THE
+// POSSIBILITY OF SUCH DAMAGE.
+
+package gotracer
+
+import (
+	"errors"
+	"io"
+	"sync"
+	"time"
+)
+
+// Number of operations that can wait in the queue of a Tracer before Submit
+// blocks.
+const queueSize = 64
+
+// ErrNotTracer is returned by OpenAndVerify when the device answers but not the
+// way a Tracer does.
+var ErrNotTracer = errors.New("device is not a Tracer")
+
+// ErrClosed is returned for operations submitted to a Tracer that is closed.
+var ErrClosed = errors.New("tracer is closed")
+
+// Operation is run by a Tracer with Submit, for example a call to one of its
+// methods. The value it returns is passed on in the Result.
+type Operation func(t *Tracer) (interface{}, error)
+
+// Result is the outcome of an Operation.
+type Result struct {
+	Value interface{}
+	Err   error
+}
+
+type queued struct {
+	op     Operation
+	result chan<- Result
+}
+
+// Tracer is a connection to a Tracer that keeps the serial port open between
+// calls. It is safe for concurrent use, calls are serialized so that the frames
+// of different calls never interleave on the port.
+type Tracer struct {
+	portName string
+	cfg      config
+
+	mu   sync.Mutex
+	port io.ReadWriteCloser
+
+	qmu     sync.Mutex
+	queue   chan queued
+	closed  bool
+	done    chan struct{}  // Closed by Close
+	sending sync.WaitGroup // Submit calls sending to the queue
+}
+
+// Open opens the Tracer connected on specified portName. Options apply to all
+// calls made on the returned Tracer. With WithAutoProfile the profile is read
+// from the Tracer before Open returns.
+func Open(portName string, opts ...Option) (*Tracer, error) {
+	cfg := newConfig(opts)
+	port, err := serialPort(portName, cfg)
+	if err != nil {
+		return nil, err
+	}
+	if cfg.autoProfile {
+		if cfg.profile, err = detectProfile(port, cfg); err != nil {
+			port.Close()
+			return nil, err
+		}
+	}
+	return &Tracer{portName: portName, cfg: cfg, port: port, done: make(chan struct{})}, nil
+}
+
+// OpenAndVerify opens the Tracer connected on specified portName like Open and
+// confirms it is a Tracer by reading its rated array voltage, which must get a
+// response with a valid checksum and a voltage other than zero. The port is
+// closed again if it is not.
+func OpenAndVerify(portName string, opts ...Option) (*Tracer, error) {
+	t, err := Open(portName, opts...)
+	if err != nil {
+		return nil, err
+	}
+	err = t.do(func(port io.ReadWriter, cfg config) error {
+		regs, err := readRegisters(port, cfg, funcReadInputRegisters, regRatedArrayVoltage, 1)
+		if err != nil {
+			return err
+		}
+		if regs[0] == 0 {
+			return ErrNotTracer
+		}
+		return nil
+	})
+	if err != nil {
+		t.Close()
+		return nil, err
+	}
+	return t, nil
+}
+
+// Close closes the serial port. Operations still waiting in the queue fail with
+// ErrClosed.
+func (t *Tracer) Close() error {
+	t.qmu.Lock()
+	if !t.closed {
+		t.closed = true
+		close(t.done)
+	}
+	t.qmu.Unlock()
+
+	t.mu.Lock()
+	defer t.mu.Unlock()
+	return t.port.Close()
+}
+
+// Runs fn with exclusive access to the port. With a rate limiter each call is
+// also paced by it.
+func (t *Tracer) do(fn func(port io.ReadWriter, cfg config) error) error {
+	t.mu.Lock()
+	defer t.mu.Unlock()
+	if t.cfg.limiter != nil {
+		release, err := t.cfg.limiter.acquire(t.portName)
+		if err != nil {
+			return err
+		}
+		defer release()
+	}
+	return fn(t.port, t.cfg)
+}
+
+// Status reads information from the Tracer.
+func (t *Tracer) Status() (s TracerStatus, err error) {
+	r, err := t.StatusRaw()
+	if err != nil {
+		return
+	}
+	return t.cfg.decoded(r.Scaled())
+}
+
+// StatusRaw reads information from the Tracer without scaling the register values.
+func (t *Tracer) StatusRaw() (r RawStatus, err error) {
+	err = t.do(func(port io.ReadWriter, cfg config) error {
+		r, err = readStatus(port, cfg, queryStateCommand)
+		return err
+	})
+	return
+}
+
+// FastStatus reads the live values of the Tracer using a single command, see
+// the package level FastStatus for the values left out.
+func (t *Tracer) FastStatus() (s TracerStatus, err error) {
+	err = t.do(func(port io.ReadWriter, cfg config) error {
+		s, err = readFastStatus(port, cfg)
+		return err
+	})
+	return
+}
+
+// ReadBattery reads the live battery values of the Tracer, see the package level
+// ReadBattery.
+func (t *Tracer) ReadBattery() (b BatteryReading, err error) {
+	err = t.do(func(port io.ReadWriter, cfg config) error {
+		b, err = readBattery(port, cfg)
+		return err
+	})
+	return
+}
+
+// EnergyStatus reads the energy counters of the Tracer, see the package level
+// EnergyStatus.
+func (t *Tracer) EnergyStatus() (e EnergyReading, err error) {
+	err = t.do(func(port io.ReadWriter, cfg config) error {
+		e, err = readEnergy(port, cfg)
+		return err
+	})
+	return
+}
+
+// ReadClock reads the real time clock of the Tracer, see the package level
+// ReadClock.
+func (t *Tracer) ReadClock() (c time.Time, err error) {
+	err = t.do(func(port io.ReadWriter, cfg config) error {
+		c, err = readClock(port, cfg)
+		return err
+	})
+	return
+}
+
+// SetLoad turns the load on or off, see the package level SetLoad.
+func (t *Tracer) SetLoad(on bool) error {
+	return t.do(func(port io.ReadWriter, cfg config) error {
+		return writeCoil(port, cfg, coilLoad, on)
+	})
+}
+
+// SetManualLoadControl takes manual control of the load or hands it back to the
+// controller, see the package level SetManualLoadControl.
+func (t *Tracer) SetManualLoadControl(enabled bool) error {
+	return t.do(func(port io.ReadWriter, cfg config) error {
+		return writeCoil(port, cfg, coilManualControl, enabled)
+	})
+}
+
+// ReadLoadControl reads the load control coils, see the package level
+// ReadLoadControl.
+func (t *Tracer) ReadLoadControl() (c LoadControl, err error) {
+	err = t.do(func(port io.ReadWriter, cfg config) error {
+		c, err = readLoadControl(port, cfg)
+		return err
+	})
+	return
+}
+
+// SetDefaultLoad sets whether the load is on in LoadModeManual, see the package
+// level SetDefaultLoad.
+func (t *Tracer) SetDefaultLoad(on bool) error {
+	return t.do(func(port io.ReadWriter, cfg config) error {
+		return writeCoil(port, cfg, coilDefaultLoad, on)
+	})
+}
+
+// SetLoadMode sets how the Tracer controls the load.
+func (t *Tracer) SetLoadMode(m LoadMode) error {
+	return t.do(func(port io.ReadWriter, cfg config) error {
+		return writeRegisters(port, cfg, regLoadMode, []uint16{uint16(m)})
+	})
+}
+
+// SetLoadTimer writes the load control mode and timer periods, see the package
+// level SetLoadTimer.
+func (t *Tracer) SetLoadTimer(l LoadTimer) error {
+	return t.do(func(port io.ReadWriter, cfg config) error {
+		return writeLoadTimer(port, cfg, l)
+	})
+}
+
+// Submit queues op to be run by the Tracer and returns a channel receiving its
+// result. Operations are run one at a time in the order they are submitted,
+// so reads and writes from several goroutines never overlap. Submit blocks
+// while the queue is full, until there is room or the Tracer is closed. An
+// Operation may submit other operations but must not wait for their results,
+// since they run after it.
+func (t *Tracer) Submit(op Operation) <-chan Result {
+	result := make(chan Result, 1)
+	t.qmu.Lock()
+	if t.closed {
+		t.qmu.Unlock()
+		result <- Result{Err: ErrClosed}
+		return result
+	}
+	if t.queue == nil {
+		t.queue = make(chan queued, queueSize)
+		go t.runQueue(t.queue)
+	}
+	queue := t.queue
+	t.sending.Add(1)
+	t.qmu.Unlock()
+
+	defer t.sending.Done()
+	select {
+	case queue <- queued{op, result}:
+	case <-t.done:
+		result <- Result{Err: ErrClosed}
+	}
+	return result
+}
+
+// Runs the queued operations until the Tracer is closed, then fails those still
+// in the queue with ErrClosed.
+func (t *Tracer) runQueue(queue chan queued) {
+	for {
+		select {
+		case q := <-queue:
+			select {
+			case <-t.done:
+				q.result <- Result{Err: ErrClosed}
+			default:
+				v, err := q.op(t)
+				q.result <- Result{v, err}
+			}
+		case <-t.done:
+			// No Submit sends once those already sending have returned.
+			t.sending.Wait()
+			for {
+				select {
+				case q := <-queue:
+					q.result <- Result{Err: ErrClosed}
+				default:
+					return
+				}
+			}
+		}
+	}
+}
@@ -0,0 +1,133 @@
+// Copyright (c) 2015, Roland Bali (roland.bali@spagettikod.se), Spagettikod
+// All rights reserved.
+//
+// Redistribution and use in source and binary forms, with or without modification,
+// are permitted provided that the following conditions are met:
+//
+// 1. Redistributions of source code must retain the above copyright notice, this
+//    list of conditions and the following disclaimer.
+//
+// 2. Redistributions in binary form must reproduce the above copyright notice, this
+//    list of conditions and the following disclaimer in the documentation and/or
+//    other materials provided with the distribution.
+//
+// 3. Neither the name of the copyright holder nor the names of its contributors may
+//    be used to endorse or promote products derived from this software without
+//    specific prior written permission.
+//
+// THIS SOFTWARE IS PROVIDED BY THE COPYRIGHT HOLDERS AND CONTRIBUTORS "AS IS" AND
+// ANY EXPRESS OR IMPLIED WARRANTIES, INCLUDING, BUT NOT LIMITED TO, THE IMPLIED
+// WARRANTIES OF MERCHANTABILITY AND FITNESS FOR A PARTICULAR PURPOSE ARE DISCLAIMED.
+// IN NO EVENT SHALL THE COPYRIGHT HOLDER OR CONTRIBUTORS BE LIABLE FOR ANY DIRECT,
+// INDIRECT, INCIDENTAL, SPECIAL, EXEMPLARY, OR CONSEQUENTIAL DAMAGES (INCLUDING, BUT
+// NOT LIMITED TO, PROCUREMENT OF SUBSTITUTE GOODS OR SERVICES; LOSS OF USE, DATA, OR
+// PROFITS; OR BUSINESS INTERRUPTION) HOWEVER CAUSED AND ON ANY THEORY OF LIABILITY,
+// WHETHER IN CONTRACT, STRICT LIABILITY, OR TORT (INCLUDING NEGLIGENCE OR OTHERWISE)
+// ARISING IN ANY WAY OUT OF THE USE OF THIS SOFTWARE, EVEN IF ADVISED OF THE
+// POSSIBILITY OF SUCH DAMAGE.
+
+package gotracer
+
+import (
+	"sync"
+	"testing"
+	"time"
+)
+
+func TestTracerConcurrentCallsDoNotInterleave(t *testing.T) {
+	f := newFakeTracer()
+	f.input[regRatedArrayVoltage] = 15000
+	tr := f.tracer()
+	defer tr.Close()
+
+	var wg sync.WaitGroup
+	errs := make(chan error, 64)
+	for i := 0; i < 16; i++ {
+		wg.Add(1)
+		go func(i int) {
+			defer wg.Done()
+			for j := 0; j < 10; j++ {
+				var err error
+				switch (i + j) % 4 {
+				case 0:
+					_, err = tr.Status()
+				case 1:
+					err = tr.SetLoad(j%2 == 0)
+				case 2:
+					_, err = tr.ReadLoadControl()
+				case 3:
+					_, err = tr.FastStatus()
+				}
+				if err != nil {
+					errs <- err
+					return
+				}
+			}
+		}(i)
+	}
+	wg.Wait()
+	close(errs)
+	for err := range errs {
+		t.Error(err)
+	}
+	if f.interleaved {
+		t.Error("a request was sent before the response to the previous one was read")
+	}
+}
+
+func TestSubmitBlockedByFullQueueFailsOnClose(t *testing.T) {
+	tr := newFakeTracer().tracer()
+	release := make(chan struct{})
+	started := make(chan struct{})
+	tr.Submit(func(*Tracer) (interface{}, error) {
+		close(started)
+		<-release
+		return nil, nil
+	})
+	<-started
+	for i := 0; i < queueSize; i++ {
+		tr.Submit(func(*Tracer) (interface{}, error) { return nil, nil })
+	}
+
+	blocked := make(chan (<-chan Result))
+	go func() {
+		blocked <- tr.Submit(func(*Tracer) (interface{}, error) { return nil, nil })
+	}()
+	time.Sleep(10 * time.Millisecond)
+	closed := make(chan error)
+	go func() { closed <- tr.Close() }()
+
+	select {
+	case r := <-blocked:
+		if res := <-r; res.Err != ErrClosed {
+			t.Errorf("blocked Submit gave %v, want ErrClosed", res.Err)
+		}
+	case <-time.After(time.Second):
+		t.Fatal("Submit still blocked after Close")
+	}
+	close(release)
+	if err := <-closed; err != nil {
+		t.Error(err)
+	}
+}
+
+func TestOperationSubmittingOperation(t *testing.T) {
+	tr := newFakeTracer().tracer()
+	defer tr.Close()
+	var inner <-chan Result
+	r := <-tr.Submit(func(t *Tracer) (interface{}, error) {
+		inner = t.Submit(func(*Tracer) (interface{}, error) { return 2, nil })
+		return 1, nil
+	})
+	if r.Value != 1 {
+		t.Errorf("outer result %v, want 1", r.Value)
+	}
+	select {
+	case r := <-inner:
+		if r.Value != 2 {
+			t.Errorf("inner result %v, want 2", r.Value)
+		}
+	case <-time.After(time.Second):
+		t.Fatal("inner operation never ran")
+	}
+}
@@ -0,0 +1,223 @@
+// Copyright (c) 2015, Roland Bali (roland.bali@spagettikod.se), Spagettikod
+// All rights reserved.
+//
+// Redistribution and use in source and binary forms, with or without modification,
+// are permitted provided that the following conditions are met:
+//
+// 1. Redistributions of source code must retain the above copyright notice, this
+//    list of conditions and the following disclaimer.
+//
+// 2. Redistributions in binary form must reproduce the above copyright notice, this
+//    list of conditions and the following disclaimer in the documentation and/or
+//    other materials provided with the distribution.
+//
+// 3. Neither the name of the copyright holder nor the names of its contributors may
+//    be used to endorse or promote products derived from this software without
+//    specific prior written permission.
+//
+// THIS SOFTWARE IS PROVIDED BY THE COPYRIGHT HOLDERS AND CONTRIBUTORS "AS IS" AND
+// ANY EXPRESS OR IMPLIED WARRANTIES, INCLUDING, BUT NOT LIMITED TO, THE IMPLIED
+// WARRANTIES OF MERCHANTABILITY AND FITNESS FOR A PARTICULAR PURPOSE ARE DISCLAIMED.
+// IN NO EVENT SHALL THE COPYRIGHT HOLDER OR CONTRIBUTORS BE LIABLE FOR ANY DIRECT,
+// INDIRECT, INCIDENTAL, SPECIAL, EXEMPLARY, OR CONSEQUENTIAL DAMAGES (INCLUDING, BUT
+// NOT LIMITED TO, PROCUREMENT OF SUBSTITUTE GOODS OR SERVICES; LOSS OF USE, DATA, OR
+// PROFITS; OR BUSINESS INTERRUPTION) HOWEVER CAUSED AND ON ANY THEORY OF LIABILITY,
+// WHETHER IN CONTRACT, STRICT LIABILITY, OR TORT (INCLUDING NEGLIGENCE OR OTHERWISE)
+// ARISING IN ANY WAY OUT OF THE USE OF THIS SOFTWARE, EVEN IF ADVISED OF THE
+// POSSIBILITY OF SUCH DAMAGE.
+
+package gotracer
+
+import (
+	"encoding/json"
+	"fmt"
+	"math"
+	"time"
+)
+
+// Volts is an electric potential in volts.
+type Volts float32
+
+// Amps is an electric current in amperes.
+type Amps float32
+
+// Watts is a power in watts.
+type Watts float32
+
+// KWh is an energy in kilowatt hours.
+type KWh float32
+
+// Celsius is a temperature in degrees Celsius.
+type Celsius float32
+
+func (v Volts) String() string   { return fmt.Sprintf("%.2f V", float32(v)) }
+func (a Amps) String() string    { return fmt.Sprintf("%.2f A", float32(a)) }
+func (w Watts) String() string   { return fmt.Sprintf("%.2f W", float32(w)) }
+func (e KWh) String() string     { return fmt.Sprintf("%.2f kWh", float32(e)) }
+func (c Celsius) String() string { return fmt.Sprintf("%.2f C", float32(c)) }
+
+// TypedStatus is a view of TracerStatus where each value carries its unit in
+// its type, mixing up for example current and power becomes a compile error.
+type TypedStatus struct {
+	ArrayVoltage           Volts
+	ArrayCurrent           Amps
+	ArrayPower             Watts
+	ArrayOverVoltage       bool
+	BatteryVoltage         Volts
+	BatteryCurrent         Amps
+	BatterySOC             int32 // (%)
+	BatteryTemp            Celsius
+	BatteryMaxVoltage      Volts
+	BatteryMinVoltage      Volts
+	DeviceTemp             Celsius
+	LoadVoltage            Volts
+	LoadCurrent            Amps
+	LoadPower              Watts
+	Load                   bool
+	NoLoad                 bool
+	EnergyConsumedDaily    KWh
+	EnergyConsumedMonthly  KWh
+	EnergyConsumedAnnual   KWh
+	EnergyConsumedTotal    KWh
+	EnergyGeneratedDaily   KWh
+	EnergyGeneratedMonthly KWh
+	EnergyGeneratedAnnual  KWh
+	EnergyGeneratedTotal   KWh
+	Timestamp              time.Time
+	BatteryStatus          BatteryStatus
+	LoadState              LoadState
+	ChargingFaults         ChargingFaults
+	HeatsinkTemp           Celsius
+}
+
+// Typed returns the reading with values typed by their unit.
+func (t TracerStatus) Typed() TypedStatus {
+	return TypedStatus{
+		ArrayVoltage:           Volts(t.ArrayVoltage),
+		ArrayCurrent:           Amps(t.ArrayCurrent),
+		ArrayPower:             Watts(t.ArrayPower),
+		ArrayOverVoltage:       t.ArrayOverVoltage,
+		BatteryVoltage:         Volts(t.BatteryVoltage),
+		BatteryCurrent:         Amps(t.BatteryCurrent),
+		BatterySOC:             t.BatterySOC,
+		BatteryTemp:            Celsius(t.BatteryTemp),
+		BatteryMaxVoltage:      Volts(t.BatteryMaxVoltage),
+		BatteryMinVoltage:      Volts(t.BatteryMinVoltage),
+		DeviceTemp:             Celsius(t.DeviceTemp),
+		LoadVoltage:            Volts(t.LoadVoltage),
+		LoadCurrent:            Amps(t.LoadCurrent),
+		LoadPower:              Watts(t.LoadPower),
+		Load:                   t.Load,
+		NoLoad:                 t.NoLoad,
+		EnergyConsumedDaily:    KWh(t.EnergyConsumedDaily),
+		EnergyConsumedMonthly:  KWh(t.EnergyConsumedMonthly),
+		EnergyConsumedAnnual:   KWh(t.EnergyConsumedAnnual),
+		EnergyConsumedTotal:    KWh(t.EnergyConsumedTotal),
+		EnergyGeneratedDaily:   KWh(t.EnergyGeneratedDaily),
+		EnergyGeneratedMonthly: KWh(t.EnergyGeneratedMonthly),
+		EnergyGeneratedAnnual:  KWh(t.EnergyGeneratedAnnual),
+		EnergyGeneratedTotal:   KWh(t.EnergyGeneratedTotal),
+		Timestamp:              t.Timestamp,
+		BatteryStatus:          t.BatteryStatus,
+		LoadState:              t.LoadState,
+		ChargingFaults:         t.ChargingFaults,
+		HeatsinkTemp:           Celsius(t.HeatsinkTemp),
+	}
+}
+
+// TracerStatus64 is TracerStatus with float64 values, rounded to the two
+// decimals the register scaling yields, for arithmetic and output without the
+// artifacts of float32.
+type TracerStatus64 struct {
+	ArrayVoltage           float64   `json:"pvv"`
+	ArrayCurrent           float64   `json:"pvc"`
+	ArrayPower             float64   `json:"pvp"`
+	ArrayOverVoltage       bool      `json:"pvov"`
+	BatteryVoltage         float64   `json:"bv"`
+	BatteryCurrent         float64   `json:"bc"`
+	BatterySOC             int32     `json:"bsoc"`
+	BatteryTemp            float64   `json:"btemp"`
+	BatteryMaxVoltage      float64   `json:"bmaxv"`
+	BatteryMinVoltage      float64   `json:"bminv"`
+	DeviceTemp             float64   `json:"devtemp"`
+	LoadVoltage            float64   `json:"lv"`
+	LoadCurrent            float64   `json:"lc"`
+	LoadPower              float64   `json:"lp"`
+	Load                   bool      `json:"load"`
+	NoLoad                 bool      `json:"noload"`
+	EnergyConsumedDaily    float64   `json:"ecd"`
+	EnergyConsumedMonthly  float64   `json:"ecm"`
+	EnergyConsumedAnnual   float64   `json:"eca"`
+	EnergyConsumedTotal    float64   `json:"ect"`
+	EnergyGeneratedDaily   float64   `json:"egd"`
+	EnergyGeneratedMonthly float64   `json:"egm"`
+	EnergyGeneratedAnnual  float64   `json:"ega"`
+	EnergyGeneratedTotal   float64   `json:"egt"`
+	Timestamp              time.Time `json:"t"`
+
+	BatteryStatus  BatteryStatus  `json:"bstatus"`
+	LoadState      LoadState      `json:"lstate"`
+	ChargingFaults ChargingFaults `json:"cfaults"`
+	HeatsinkTemp   float64        `json:"hstemp"`
+}
+
+// MarshalJSON adds the schema version, under "v", and omits the load values when
+// the controller has no load terminal, like TracerStatus.MarshalJSON.
+func (t TracerStatus64) MarshalJSON() ([]byte, error) {
+	type status TracerStatus64
+	if !t.NoLoad {
+		return json.Marshal(struct {
+			Version int `json:"v"`
+			status
+		}{SchemaVersion, status(t)})
+	}
+	// Nil fields shadowing the load values of status leave them out.
+	return json.Marshal(struct {
+		Version int `json:"v"`
+		status
+		LoadVoltage *float64 `json:"lv,omitempty"`
+		LoadCurrent *float64 `json:"lc,omitempty"`
+		LoadPower   *float64 `json:"lp,omitempty"`
+		Load        *bool    `json:"load,omitempty"`
+	}{Version: SchemaVersion, status: status(t)})
+}
+
+// To64 returns the reading with float64 values.
+func (t TracerStatus) To64() TracerStatus64 {
+	return TracerStatus64{
+		ArrayVoltage:           round2(t.ArrayVoltage),
+		ArrayCurrent:           round2(t.ArrayCurrent),
+		ArrayPower:             round2(t.ArrayPower),
+		ArrayOverVoltage:       t.ArrayOverVoltage,
+		BatteryVoltage:         round2(t.BatteryVoltage),
+		BatteryCurrent:         round2(t.BatteryCurrent),
+		BatterySOC:             t.BatterySOC,
+		BatteryTemp:            round2(t.BatteryTemp),
+		BatteryMaxVoltage:      round2(t.BatteryMaxVoltage),
+		BatteryMinVoltage:      round2(t.BatteryMinVoltage),
+		DeviceTemp:             round2(t.DeviceTemp),
+		LoadVoltage:            round2(t.LoadVoltage),
+		LoadCurrent:            round2(t.LoadCurrent),
+		LoadPower:              round2(t.LoadPower),
+		Load:                   t.Load,
+		NoLoad:                 t.NoLoad,
+		EnergyConsumedDaily:    round2(t.EnergyConsumedDaily),
+		EnergyConsumedMonthly:  round2(t.EnergyConsumedMonthly),
+		EnergyConsumedAnnual:   round2(t.EnergyConsumedAnnual),
+		EnergyConsumedTotal:    round2(t.EnergyConsumedTotal),
+		EnergyGeneratedDaily:   round2(t.EnergyGeneratedDaily),
+		EnergyGeneratedMonthly: round2(t.EnergyGeneratedMonthly),
+		EnergyGeneratedAnnual:  round2(t.EnergyGeneratedAnnual),
+		EnergyGeneratedTotal:   round2(t.EnergyGeneratedTotal),
+		Timestamp:              t.Timestamp,
+		BatteryStatus:          t.BatteryStatus,
+		LoadState:              t.LoadState,
+		ChargingFaults:         t.ChargingFaults,
+		HeatsinkTemp:           round2(t.HeatsinkTemp),
+	}
+}
+
+// Returns v as a float64 rounded to two decimals.
+func round2(v float32) float64 {
+	return math.Round(float64(v)*100) / 100
+}
@@ -0,0 +1,131 @@
+// Copyright (c) 2015, Roland Bali (roland.bali@spagettikod.se), Spagettikod
+// All rights reserved.
+//
+// Redistribution and use in source and binary forms, with or without modification,
+// are permitted provided that the following conditions are met:
+//
+// 1. Redistributions of source code must retain the above copyright notice, this
+//    list of conditions and the following disclaimer.
+//
+// 2. Redistributions in binary form must reproduce the above copyright notice, this
+//    list of conditions and the following disclaimer in the documentation and/or
+//    other materials provided with the distribution.
+//
+// 3. Neither the name of the copyright holder nor the names of its contributors may
+//    be used to endorse or promote products derived from this software without
+//    specific prior written permission.
+//
+// THIS SOFTWARE IS PROVIDED BY THE COPYRIGHT HOLDERS AND CONTRIBUTORS "AS IS" AND
+// ANY EXPRESS OR IMPLIED WARRANTIES, INCLUDING, BUT NOT LIMITED TO, THE IMPLIED
+// WARRANTIES OF MERCHANTABILITY AND FITNESS FOR A PARTICULAR PURPOSE ARE DISCLAIMED.
+// IN NO EVENT SHALL THE COPYRIGHT HOLDER OR CONTRIBUTORS BE LIABLE FOR ANY DIRECT,
+// INDIRECT, INCIDENTAL, SPECIAL, EXEMPLARY, OR CONSEQUENTIAL DAMAGES (INCLUDING, BUT
+// NOT LIMITED TO, PROCUREMENT OF SUBSTITUTE GOODS OR SERVICES; LOSS OF USE, DATA, OR
+// PROFITS; OR BUSINESS INTERRUPTION) HOWEVER CAUSED AND ON ANY THEORY OF LIABILITY,
+// WHETHER IN CONTRACT, STRICT LIABILITY, OR TORT (INCLUDING NEGLIGENCE OR OTHERWISE)
+// ARISING IN ANY WAY OUT OF THE USE OF THIS SOFTWARE, EVEN IF ADVISED OF THE
+// POSSIBILITY OF SUCH DAMAGE.
+
+package gotracer
+
+import (
+	"errors"
+	"fmt"
+)
+
+// Validate checks that the values of the reading are within their possible
+// ranges, returning an error describing the first value that is not.
+func (t TracerStatus) Validate() error {
+	if t.Timestamp.IsZero() {
+		return fmt.Errorf("reading has no timestamp")
+	}
+	if t.BatterySOC < 0 || t.BatterySOC > 100 {
+		return fmt.Errorf("battery SOC %v%% out of range", t.BatterySOC)
+	}
+	nonNegative := []struct {
+		name  string
+		value float32
+	}{
+		{"array voltage", t.ArrayVoltage},
+		{"array current", t.ArrayCurrent},
+		{"array power", t.ArrayPower},
+		{"battery voltage", t.BatteryVoltage},
+		{"load voltage", t.LoadVoltage},
+		{"load current", t.LoadCurrent},
+		{"load power", t.LoadPower},
+		{"daily consumed energy", t.EnergyConsumedDaily},
+		{"monthly consumed energy", t.EnergyConsumedMonthly},
+		{"annual consumed energy", t.EnergyConsumedAnnual},
+		{"total consumed energy", t.EnergyConsumedTotal},
+		{"daily generated energy", t.EnergyGeneratedDaily},
+		{"monthly generated energy", t.EnergyGeneratedMonthly},
+		{"annual generated energy", t.EnergyGeneratedAnnual},
+		{"total generated energy", t.EnergyGeneratedTotal},
+	}
+	for _, v := range nonNegative {
+		if v.value < 0 {
+			return fmt.Errorf("%s %.2f is negative", v.name, v.value)
+		}
+	}
+	return nil
+}
+
+// ErrInconsistent is returned, wrapping the error of CheckConsistency, when a
+// reading made with WithConsistencyCheck is inconsistent.
+var ErrInconsistent = errors.New("inconsistent reading")
+
+// WithConsistencyCheck makes Status, and the other functions returning a
+// TracerStatus, fail with ErrInconsistent for readings failing CheckConsistency
+// with tolerance, for example array power while the array is dark. Watch reports
+// them on Errors and skips them.
+func WithConsistencyCheck(tolerance float32) Option {
+	return func(c *config) {
+		c.checkOn, c.checkTolerance = true, tolerance
+	}
+}
+
+// Power, (W), a computed power may differ from the reported one by on top of the
+// tolerance, covering the resolution of the readings at low power.
+const consistencySlack = 1
+
+// CheckConsistency checks that the values of the reading agree with each other,
+// returning an error describing the first mismatch. Array and load power must
+// equal voltage times current within tolerance, a fraction such as 0.1 for 10%.
+// A reading that passes Validate may still fail here, for example with array
+// power while the array voltage is zero, which points to a bad frame.
+func (t TracerStatus) CheckConsistency(tolerance float32) error {
+	if err := checkPower("array", t.ArrayVoltage, t.ArrayCurrent, t.ArrayPower, tolerance); err != nil {
+		return err
+	}
+	if !t.NoLoad {
+		if err := checkPower("load", t.LoadVoltage, t.LoadCurrent, t.LoadPower, tolerance); err != nil {
+			return err
+		}
+	}
+	if t.BatteryMinVoltage > t.BatteryMaxVoltage {
+		return fmt.Errorf("battery lowest voltage %.2f above maximum voltage %.2f", t.BatteryMinVoltage, t.BatteryMaxVoltage)
+	}
+	return nil
+}
+
+// Returns an error if power p differs from v times c by more than tolerance.
+func checkPower(name string, v, c, p, tolerance float32) error {
+	if powerMismatch(v, c, p, tolerance) {
+		return fmt.Errorf("%s power %.2f does not match voltage %.2f times current %.2f", name, p, v, c)
+	}
+	return nil
+}
+
+// Reports whether power p differs from v times c by more than tolerance.
+func powerMismatch(v, c, p, tolerance float32) bool {
+	computed := v * c
+	diff := p - computed
+	if diff < 0 {
+		diff = -diff
+	}
+	larger := p
+	if computed > larger {
+		larger = computed
+	}
+	return diff > tolerance*larger+consistencySlack
+}
@@ -0,0 +1,68 @@
+// Copyright (c) 2015, Roland Bali (roland.bali@spagettikod.se), Spagettikod
+// All rights reserved.
+//
+// Redistribution and use in source and binary forms, with or without modification,
+// are permitted provided that the following conditions are met:
+//
+// 1. Redistributions of source code must retain the above copyright notice, this
+//    list of conditions and the following disclaimer.
+//
+// 2. Redistributions in binary form must reproduce the above copyright notice, this
+//    list of conditions and the following disclaimer in the documentation and/or
+//    other materials provided with the distribution.
+//
+// 3. Neither the name of the copyright holder nor the names of its contributors may
+//    be used to endorse or promote products derived from this software without
+//    specific prior written permission.
+//
+// THIS SOFTWARE IS PROVIDED BY THE COPYRIGHT HOLDERS AND CONTRIBUTORS "AS IS" AND
+// ANY EXPRESS OR IMPLIED WARRANTIES, INCLUDING, BUT NOT LIMITED TO, THE IMPLIED
+// WARRANTIES OF MERCHANTABILITY AND FITNESS FOR A PARTICULAR PURPOSE ARE DISCLAIMED.
+// IN NO EVENT SHALL THE COPYRIGHT HOLDER OR CONTRIBUTORS BE LIABLE FOR ANY DIRECT,
+// INDIRECT, INCIDENTAL, SPECIAL, EXEMPLARY, OR CONSEQUENTIAL DAMAGES (INCLUDING, BUT
+// NOT LIMITED TO, PROCUREMENT OF SUBSTITUTE GOODS OR SERVICES; LOSS OF USE, DATA, OR
+// PROFITS; OR BUSINESS INTERRUPTION) HOWEVER CAUSED AND ON ANY THEORY OF LIABILITY,
+// WHETHER IN CONTRACT, STRICT LIABILITY, OR TORT (INCLUDING NEGLIGENCE OR OTHERWISE)
+// ARISING IN ANY WAY OUT OF THE USE OF THIS SOFTWARE, EVEN IF ADVISED OF THE
+// POSSIBILITY OF SUCH DAMAGE.
+
+package gotracer
+
+import (
+	"errors"
+	"testing"
+)
+
+func TestConsistencyCheckDarkArray(t *testing.T) {
+	f := newFakeTracer()
+	f.input[0x3104] = 500 // 5 W array power with no array voltage or current
+	if _, err := f.tracer().Status(); err != nil {
+		t.Fatalf("without the check: %v", err)
+	}
+	s, err := f.tracer(WithConsistencyCheck(0.1)).Status()
+	if !errors.Is(err, ErrInconsistent) {
+		t.Errorf("dark array with power gave %+v, %v, want ErrInconsistent", s, err)
+	}
+}
+
+func TestConsistencyCheckTolerance(t *testing.T) {
+	cfg := newConfig([]Option{WithConsistencyCheck(0.1)})
+	// 10 V times 10 A is 100 W, allowed to differ by 10% of the larger power
+	// and consistencySlack.
+	tests := []struct {
+		power float32
+		ok    bool
+	}{
+		{100, true},
+		{112, true},
+		{112.5, false},
+		{89, true},
+		{88, false},
+	}
+	for _, tt := range tests {
+		s := TracerStatus{ArrayVoltage: 10, ArrayCurrent: 10, ArrayPower: tt.power, NoLoad: true}
+		if _, err := cfg.decoded(s); (err == nil) != tt.ok {
+			t.Errorf("array power %.1f gave %v, want ok %t", tt.power, err, tt.ok)
+		}
+	}
+}
@@ -0,0 +1,318 @@
+// Copyright (c) 2015, Roland Bali (roland.bali@spagettikod.se), Spagettikod
+// All rights reserved.
+//
+// Redistribution and use in source and binary forms, with or without modification,
+// are permitted provided that the following conditions are met:
+//
+// 1. Redistributions of source code must retain the above copyright notice, this
+//    list of conditions and the following disclaimer.
+//
+// 2. Redistributions in binary form must reproduce the above copyright notice, this
+//    list of conditions and the following disclaimer in the documentation and/or
+//    other materials provided with the distribution.
+//
+// 3. Neither the name of the copyright holder nor the names of its contributors may
+//    be used to endorse or promote products derived from this software without
+//    specific prior written permission.
+//
+// THIS SOFTWARE IS PROVIDED BY THE COPYRIGHT HOLDERS AND CONTRIBUTORS "AS IS" AND
+// ANY EXPRESS OR IMPLIED WARRANTIES, INCLUDING, BUT NOT LIMITED TO, THE IMPLIED
+// WARRANTIES OF MERCHANTABILITY AND FITNESS FOR A PARTICULAR PURPOSE ARE DISCLAIMED.
+// IN NO EVENT SHALL THE COPYRIGHT HOLDER OR CONTRIBUTORS BE LIABLE FOR ANY DIRECT,
+// INDIRECT, INCIDENTAL, SPECIAL, EXEMPLARY, OR CONSEQUENTIAL DAMAGES (INCLUDING, BUT
+// NOT LIMITED TO, PROCUREMENT OF SUBSTITUTE GOODS OR SERVICES; LOSS OF USE, DATA, OR
+// PROFITS; OR BUSINESS INTERRUPTION) HOWEVER CAUSED AND ON ANY THEORY OF LIABILITY,
+// WHETHER IN CONTRACT, STRICT LIABILITY, OR TORT (INCLUDING NEGLIGENCE OR OTHERWISE)
+// ARISING IN ANY WAY OUT OF THE USE OF THIS SOFTWARE, EVEN IF ADVISED OF THE
+// POSSIBILITY OF SUCH DAMAGE.
+
+package gotracer
+
+import (
+	"errors"
+	"fmt"
+	"sync"
+	"time"
+)
+
+// Number of warnings kept for a slow receiver before new ones are dropped.
+const warningQueueSize = 16
+
+// WarningCategory is the kind of a Warning.
+type WarningCategory int
+
+// Warning categories.
+const (
+	WarningRetry      WarningCategory = iota // A command failed and was sent again
+	WarningInvalid                           // A reading has values out of range, see Validate
+	WarningResync                            // A response belonged to another command, the commands were sent again
+	WarningDropped                           // A reading was dropped since the Readings buffer was full
+	WarningRecomputed                        // A reported power was replaced by voltage times current
+	WarningThrottled                         // A write was refused by the WriteGuard
+)
+
+func (c WarningCategory) String() string {
+	switch c {
+	case WarningRetry:
+		return "retry"
+	case WarningInvalid:
+		return "invalid"
+	case WarningResync:
+		return "resync"
+	case WarningDropped:
+		return "dropped"
+	case WarningRecomputed:
+		return "recomputed"
+	case WarningThrottled:
+		return "throttled"
+	}
+	return "unknown"
+}
+
+// Warning is a problem that did not stop a reading from being made, such as a
+// command that succeeded only when retried.
+type Warning struct {
+	Category  WarningCategory `json:"category"`
+	Detail    string          `json:"detail"`
+	Timestamp time.Time       `json:"t"`
+}
+
+func (w Warning) String() string {
+	return fmt.Sprintf("%v: %s", w.Category, w.Detail)
+}
+
+// Returns an option reporting warnings to fn.
+func withWarnings(fn func(Warning)) Option {
+	return func(c *config) {
+		c.warn = fn
+	}
+}
+
+// Reports a warning if the configuration has a receiver for them.
+func (c config) warning(category WarningCategory, detail string) {
+	if c.warn != nil {
+		c.warn(Warning{Category: category, Detail: detail, Timestamp: time.Now().UTC()})
+	}
+}
+
+// BufferPolicy is what Watch does with a reading when the buffer of Readings is
+// full.
+type BufferPolicy int
+
+// Buffer policies.
+const (
+	Block      BufferPolicy = iota // Wait for the reading to be received, delaying the next reading
+	DropOldest                     // Drop the oldest buffered reading to make room
+	DropNewest                     // Drop the new reading
+)
+
+// WithWatchBuffer sets the number of readings Watch buffers for a slow receiver
+// and what it does when the buffer is full. Dropped readings are reported as
+// warnings. Default is no buffer and Block. A size of zero with DropOldest or
+// DropNewest buffers one reading, without a buffer every reading not received
+// right away would be dropped. Watch fails with ErrWatchBuffer for a negative
+// size.
+func WithWatchBuffer(size int, policy BufferPolicy) Option {
+	return func(c *config) {
+		c.watchBuffer, c.watchPolicy = size, policy
+	}
+}
+
+// WithOnNewDay makes Watch read the clock of the Tracer with each reading and call
+// fn when the device day of a reading differs from that of the previous one. The
+// previous reading, prev, is the last one made before the Tracer reset its daily
+// counters at midnight and holds the final values of the day. fn is called from
+// the goroutine of the Watcher before cur is sent on Readings. The clock is read
+// before and after each reading, which is made again if midnight passed in
+// between. A failure to read the clock fails the reading like any other error.
+func WithOnNewDay(fn func(prev, cur TracerStatus)) Option {
+	return func(c *config) {
+		c.onNewDay = fn
+	}
+}
+
+// Watcher reads the Tracer at a fixed interval, see Watch.
+type Watcher struct {
+	// Readings receives each reading made.
+	Readings <-chan TracerStatus
+	// Errors receives the errors that made a reading fail. The reading is
+	// skipped and the next one is made at the next interval.
+	Errors <-chan error
+	// Warnings receives problems that did not stop a reading. Unlike readings
+	// and errors, warnings are dropped if they are not received in time.
+	Warnings <-chan Warning
+
+	tracer   *Tracer
+	stop     chan struct{}
+	wg       sync.WaitGroup
+	stopOnce sync.Once
+	stopErr  error // Error closing the port, returned by every Stop
+}
+
+// ErrInterval is returned by Watch and MonitorTo when the interval between
+// readings is not positive.
+var ErrInterval = errors.New("interval must be positive")
+
+// ErrWatchBuffer is returned by Watch when the size set by WithWatchBuffer is
+// negative.
+var ErrWatchBuffer = errors.New("negative watch buffer size")
+
+// Watch opens the Tracer connected on specified portName and reads it every
+// interval, starting right away, until Stop is called. Errors must be received
+// for reading to continue, and so must readings unless WithWatchBuffer sets a
+// policy dropping them.
+func Watch(portName string, interval time.Duration, opts ...Option) (*Watcher, error) {
+	if interval <= 0 {
+		return nil, ErrInterval
+	}
+	if newConfig(opts).watchBuffer < 0 {
+		return nil, ErrWatchBuffer
+	}
+	warnings := make(chan Warning, warningQueueSize)
+	t, err := Open(portName, append(opts[:len(opts):len(opts)], withWarnings(queueWarning(warnings)))...)
+	if err != nil {
+		return nil, err
+	}
+	return watch(t, interval, newConfig(opts), warnings), nil
+}
+
+// Returns a function sending warnings on queue, dropping them if it is full.
+func queueWarning(queue chan Warning) func(Warning) {
+	return func(w Warning) {
+		select {
+		case queue <- w:
+		default:
+		}
+	}
+}
+
+// Reads t every interval, reporting warnings on warnings, the queue t reports
+// its own warnings on.
+func watch(t *Tracer, interval time.Duration, cfg config, warnings chan Warning) *Watcher {
+	warn := queueWarning(warnings)
+	size := cfg.watchBuffer
+	if size == 0 && cfg.watchPolicy != Block {
+		size = 1
+	}
+	readings := make(chan TracerStatus, size)
+	errs := make(chan error)
+	w := &Watcher{Readings: readings, Errors: errs, Warnings: warnings, tracer: t, stop: make(chan struct{})}
+	w.wg.Add(1)
+	go func() {
+		defer w.wg.Done()
+		defer close(readings)
+		defer close(errs)
+		defer close(warnings)
+		ticker := time.NewTicker(interval)
+		defer ticker.Stop()
+		var prev TracerStatus
+		var prevClock time.Time
+		for {
+			var s TracerStatus
+			var clock time.Time
+			var err error
+			if cfg.onNewDay != nil {
+				s, clock, err = statusWithClock(t)
+			} else {
+				s, err = t.Status()
+			}
+			if err == nil {
+				if cfg.onNewDay != nil && !clock.IsZero() {
+					if !prevClock.IsZero() && !sameDay(prevClock, clock) {
+						cfg.onNewDay(prev, s)
+					}
+					prev, prevClock = s, clock
+				}
+				if verr := s.Validate(); verr != nil {
+					warn(Warning{Category: WarningInvalid, Detail: verr.Error(), Timestamp: s.Timestamp})
+				}
+				if cfg.watchPolicy == Block {
+					select {
+					case readings <- s:
+					case <-w.stop:
+						return
+					}
+				} else if !offer(readings, s, cfg.watchPolicy) {
+					warn(Warning{Category: WarningDropped, Detail: "readings buffer full", Timestamp: s.Timestamp})
+				}
+			} else {
+				select {
+				case errs <- err:
+				case <-w.stop:
+					return
+				}
+			}
+			select {
+			case <-ticker.C:
+			case <-w.stop:
+				return
+			}
+		}
+	}()
+	return w
+}
+
+// Reads the status of t between two reads of its clock and returns it with the
+// clock, the reading belongs to the device day of the clock. The reading is made
+// again if the device day changed in between, like in ReadDailyEnergy. If it
+// keeps changing the clock is returned zero, leaving the day of the reading
+// undecided.
+func statusWithClock(t *Tracer) (s TracerStatus, clock time.Time, err error) {
+	for i := 0; i < dailyEnergyAttempts; i++ {
+		before, err := t.ReadClock()
+		if err != nil {
+			return s, clock, err
+		}
+		if s, err = t.Status(); err != nil {
+			return s, clock, err
+		}
+		after, err := t.ReadClock()
+		if err != nil {
+			return s, clock, err
+		}
+		if sameDay(before, after) {
+			return s, after, nil
+		}
+	}
+	return s, time.Time{}, nil
+}
+
+// Sends s on readings without blocking, dropping s or the oldest buffered
+// reading if the buffer is full. Reports whether s was sent without dropping
+// any reading.
+func offer(readings chan TracerStatus, s TracerStatus, policy BufferPolicy) bool {
+	select {
+	case readings <- s:
+		return true
+	default:
+	}
+	if policy == DropOldest {
+		select {
+		case <-readings:
+		default:
+		}
+		select {
+		case readings <- s:
+		default:
+		}
+	}
+	return false
+}
+
+// Reports whether a and b are on the same date.
+func sameDay(a, b time.Time) bool {
+	ay, am, ad := a.Date()
+	by, bm, bd := b.Date()
+	return ay == by && am == bm && ad == bd
+}
+
+// Stop stops reading, closes the channels of the Watcher and the port. Calling
+// it again does nothing and returns the error of the first call.
+func (w *Watcher) Stop() error {
+	w.stopOnce.Do(func() {
+		close(w.stop)
+		w.wg.Wait()
+		w.stopErr = w.tracer.Close()
+	})
+	return w.stopErr
+}
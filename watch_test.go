@@ -0,0 +1,204 @@
+// Copyright (c) 2015, Roland Bali (roland.bali@spagettikod.se), Spagettikod
+// All rights reserved.
+//
+// Redistribution and use in source and binary forms, with or without modification,
+// are permitted provided that the following conditions are met:
+//
+// 1. Redistributions of source code must retain the above copyright notice, this
+//    list of conditions and the following disclaimer.
+//
+// 2. Redistributions in binary form must reproduce the above copyright notice, this
+//    list of conditions and the following disclaimer in the documentation and/or
+//    other materials provided with the distribution.
+//
+// 3. Neither the name of the copyright holder nor the names of its contributors may
+//    be used to endorse or promote products derived from this software without
+//    specific prior written permission.
+//
+// THIS SOFTWARE IS PROVIDED BY THE COPYRIGHT HOLDERS AND CONTRIBUTORS "AS IS" AND
+// ANY EXPRESS OR IMPLIED WARRANTIES, INCLUDING, BUT NOT LIMITED TO, THE IMPLIED
+// WARRANTIES OF MERCHANTABILITY AND FITNESS FOR A PARTICULAR PURPOSE ARE DISCLAIMED.
+// IN NO EVENT SHALL THE COPYRIGHT HOLDER OR CONTRIBUTORS BE LIABLE FOR ANY DIRECT,
+// INDIRECT, INCIDENTAL, SPECIAL, EXEMPLARY, OR CONSEQUENTIAL DAMAGES (INCLUDING, BUT
+// NOT LIMITED TO, PROCUREMENT OF SUBSTITUTE GOODS OR SERVICES; LOSS OF USE, DATA, OR
+// PROFITS; OR BUSINESS INTERRUPTION) HOWEVER CAUSED AND ON ANY THEORY OF LIABILITY,
+// WHETHER IN CONTRACT, STRICT LIABILITY, OR TORT (INCLUDING NEGLIGENCE OR OTHERWISE)
+// ARISING IN ANY WAY OUT OF THE USE OF THIS SOFTWARE, EVEN IF ADVISED OF THE
+// POSSIBILITY OF SUCH DAMAGE.
+
+package gotracer
+
+import (
+	"reflect"
+	"sync"
+	"testing"
+	"time"
+)
+
+// Sets the clock registers of f to c.
+func (f *fakeTracer) setClock(c time.Time) {
+	f.holding[regClock] = uint16(c.Minute())<<8 | uint16(c.Second())
+	f.holding[regClock+1] = uint16(c.Day())<<8 | uint16(c.Hour())
+	f.holding[regClock+2] = uint16(c.Year()-2000)<<8 | uint16(c.Month())
+}
+
+func TestWatchNewDayAcrossMidnight(t *testing.T) {
+	f := newFakeTracer()
+	midnight := time.Date(2024, 3, 2, 0, 0, 0, 0, time.Local)
+	f.input[0x330c] = 500 // 5 kWh generated today
+	clockReads := 0
+	f.onRequest = func(req []byte) {
+		addr := uint16(req[2])<<8 | uint16(req[3])
+		if req[1] != funcReadHoldingRegisters || addr != regClock {
+			return
+		}
+		// Midnight passes after the status of the second reading is read,
+		// before the fourth read of the clock, and resets the daily counters.
+		clockReads++
+		if clockReads <= 3 {
+			f.setClock(midnight.Add(-time.Second))
+		} else {
+			f.setClock(midnight.Add(time.Second))
+			f.input[0x330c] = 0
+		}
+	}
+
+	var mu sync.Mutex
+	var days [][2]TracerStatus
+	warnings := make(chan Warning, warningQueueSize)
+	tr := f.tracer(withWarnings(queueWarning(warnings)))
+	cfg := newConfig([]Option{WithOnNewDay(func(prev, cur TracerStatus) {
+		mu.Lock()
+		defer mu.Unlock()
+		days = append(days, [2]TracerStatus{prev, cur})
+	})})
+	w := watch(tr, time.Millisecond, cfg, warnings)
+	for i := 0; i < 3; {
+		select {
+		case <-w.Readings:
+			i++
+		case err := <-w.Errors:
+			t.Fatal(err)
+		}
+	}
+	w.Stop()
+
+	mu.Lock()
+	defer mu.Unlock()
+	if len(days) != 1 {
+		t.Fatalf("new day reported %d times, want once", len(days))
+	}
+	if prev, cur := days[0][0], days[0][1]; prev.EnergyGeneratedDaily != 5 || cur.EnergyGeneratedDaily != 0 {
+		t.Errorf("new day with previous daily generation %.2f and current %.2f, want 5 and 0", prev.EnergyGeneratedDaily, cur.EnergyGeneratedDaily)
+	}
+}
+
+func TestWatcherStopTwice(t *testing.T) {
+	warnings := make(chan Warning, warningQueueSize)
+	w := watch(newFakeTracer().tracer(), time.Millisecond, newConfig(nil), warnings)
+	go func() {
+		for range w.Errors {
+		}
+	}()
+	go func() {
+		for range w.Readings {
+		}
+	}()
+	first := w.Stop()
+	if err := w.Stop(); err != first {
+		t.Errorf("second Stop gave %v, want %v", err, first)
+	}
+}
+
+func TestWatchInterval(t *testing.T) {
+	for _, interval := range []time.Duration{0, -time.Second} {
+		if w, err := Watch("no such port", interval); err != ErrInterval {
+			t.Errorf("interval %v gave %v, %v, want ErrInterval", interval, w, err)
+		}
+	}
+}
+
+func TestWatchBufferFull(t *testing.T) {
+	tests := []struct {
+		name   string
+		size   int
+		policy BufferPolicy
+		want   []int // Readings left in the buffer, numbered from 1
+	}{
+		{"block", 2, Block, []int{1, 2}},
+		{"drop newest", 2, DropNewest, []int{1, 2}},
+		{"drop oldest", 2, DropOldest, nil},
+		{"drop newest without buffer", 0, DropNewest, []int{1}},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			f := newFakeTracer()
+			n := 0
+			f.onRequest = func(req []byte) {
+				if req[1] != 0x43 {
+					return
+				}
+				// Number the readings by the real-time data they return.
+				n++
+				for i := uint16(0); i < 23; i++ {
+					f.input[0x3100+i] = uint16(n * 100)
+				}
+			}
+			made := func() int {
+				f.mu.Lock()
+				defer f.mu.Unlock()
+				return n
+			}
+			warnings := make(chan Warning, warningQueueSize)
+			cfg := newConfig([]Option{WithWatchBuffer(tt.size, tt.policy)})
+			w := watch(f.tracer(withWarnings(queueWarning(warnings))), time.Millisecond, cfg, warnings)
+			go func() {
+				for range w.Errors {
+				}
+			}()
+			// Enough readings to fill the buffer and drop some, with Block
+			// one is made and waits for room.
+			target := tt.size + 3
+			if tt.policy == Block {
+				target = tt.size + 1
+			}
+			deadline := time.Now().Add(time.Second)
+			for made() < target && time.Now().Before(deadline) {
+				time.Sleep(time.Millisecond)
+			}
+			if tt.policy == Block {
+				time.Sleep(20 * time.Millisecond)
+				if m := made(); m != tt.size+1 {
+					t.Errorf("made %d readings with a full buffer, want %d", m, tt.size+1)
+				}
+			}
+			w.Stop()
+
+			var got []int
+			for s := range w.Readings {
+				got = append(got, int(s.ArrayVoltage))
+			}
+			dropped := false
+			for w := range w.Warnings {
+				dropped = dropped || w.Category == WarningDropped
+			}
+			if tt.policy == DropOldest {
+				// The latest readings, in order.
+				if len(got) != tt.size || got[0] < 2 || got[1] != got[0]+1 {
+					t.Errorf("buffer left with readings %v, want the latest %d", got, tt.size)
+				}
+			} else if !reflect.DeepEqual(got, tt.want) {
+				t.Errorf("buffer left with readings %v, want %v", got, tt.want)
+			}
+			if dropped != (tt.policy != Block) {
+				t.Errorf("dropped readings reported %t, want %t", dropped, tt.policy != Block)
+			}
+		})
+	}
+}
+
+func TestWatchNegativeBuffer(t *testing.T) {
+	if _, err := Watch("no such port", time.Second, WithWatchBuffer(-1, DropOldest)); err != ErrWatchBuffer {
+		t.Errorf("got %v, want ErrWatchBuffer", err)
+	}
+}
@@ -0,0 +1,104 @@
+// Copyright (c) 2015, Roland Bali (roland.bali@spagettikod.se), Spagettikod
+// All rights reserved.
+//
+// Redistribution and use in source and binary forms, with or without modification,
+// are permitted provided that the following conditions are met:
+//
+// 1. Redistributions of source code must retain the above copyright notice, this
+//    list of conditions and the following disclaimer.
+//
+// 2. Redistributions in binary form must reproduce the above copyright notice, this
+//    list of conditions and the following disclaimer in the documentation and/or
+//    other materials provided with the distribution.
+//
+// 3. Neither the name of the copyright holder nor the names of its contributors may
+//    be used to endorse or promote products derived from this software without
+//    specific prior written permission.
+//
+// THIS SOFTWARE IS PROVIDED BY THE COPYRIGHT HOLDERS AND CONTRIBUTORS "AS IS" AND
+// ANY EXPRESS OR IMPLIED WARRANTIES, INCLUDING, BUT NOT LIMITED TO, THE IMPLIED
+// WARRANTIES OF MERCHANTABILITY AND FITNESS FOR A PARTICULAR PURPOSE ARE DISCLAIMED.
+// IN NO EVENT SHALL THE COPYRIGHT HOLDER OR CONTRIBUTORS BE LIABLE FOR ANY DIRECT,
+// INDIRECT, INCIDENTAL, SPECIAL, EXEMPLARY, OR CONSEQUENTIAL DAMAGES (INCLUDING, BUT
+// NOT LIMITED TO, PROCUREMENT OF SUBSTITUTE GOODS OR SERVICES; LOSS OF USE, DATA, OR
+// PROFITS; OR BUSINESS INTERRUPTION) HOWEVER CAUSED AND ON ANY THEORY OF LIABILITY,
+// WHETHER IN CONTRACT, STRICT LIABILITY, OR TORT (INCLUDING NEGLIGENCE OR OTHERWISE)
+// ARISING IN ANY WAY OUT OF THE USE OF THIS SOFTWARE, EVEN IF ADVISED OF THE
+// POSSIBILITY OF SUCH DAMAGE.
+
+package gotracer
+
+import (
+	"errors"
+	"fmt"
+	"io"
+	"sync"
+	"time"
+)
+
+// ErrWriteThrottled is returned by writes guarded by a WriteGuard when a register
+// was written too recently.
+var ErrWriteThrottled = errors.New("setting written too recently")
+
+// WriteGuard protects the settings of the Tracer, which are stored in flash
+// memory worn by each write, from automation writing them too often. A guarded
+// write first reads the registers back and is skipped if they already hold the
+// values. A write changing a register written less than the interval ago fails
+// with ErrWriteThrottled, which is also reported as a warning. Use the same
+// WriteGuard, by passing it with WithWriteGuard, for all calls to one Tracer.
+type WriteGuard struct {
+	interval time.Duration
+
+	mu   sync.Mutex
+	last map[uint16]time.Time // Time of the last write of each register
+}
+
+// NewWriteGuard returns a WriteGuard allowing each register to be written once
+// per interval. With an interval of zero writes are only skipped when the values
+// are unchanged.
+func NewWriteGuard(interval time.Duration) *WriteGuard {
+	return &WriteGuard{interval: interval, last: make(map[uint16]time.Time)}
+}
+
+// WithWriteGuard guards writes to holding registers using g.
+func WithWriteGuard(g *WriteGuard) Option {
+	return func(c *config) {
+		c.writeGuard = g
+	}
+}
+
+// Writes regs to the holding registers starting at addr through write unless
+// they already hold the values or one of the registers changed by the write was
+// written too recently. Only the registers changed are stamped as written.
+func (g *WriteGuard) write(port io.ReadWriter, cfg config, addr uint16, regs []uint16, write func() error) error {
+	current, err := readRegisters(port, cfg, funcReadHoldingRegisters, addr, uint16(len(regs)))
+	if err != nil {
+		return err
+	}
+	var changed []uint16
+	for i, r := range regs {
+		if current[i] != r {
+			changed = append(changed, addr+uint16(i))
+		}
+	}
+	if len(changed) == 0 {
+		return nil
+	}
+
+	g.mu.Lock()
+	defer g.mu.Unlock()
+	now := time.Now()
+	for _, a := range changed {
+		if last, ok := g.last[a]; ok && now.Sub(last) < g.interval {
+			cfg.warning(WarningThrottled, fmt.Sprintf("write of register %#04x throttled, last written %v ago", a, now.Sub(last).Round(time.Second)))
+			return ErrWriteThrottled
+		}
+	}
+	if err := write(); err != nil {
+		return err
+	}
+	for _, a := range changed {
+		g.last[a] = now
+	}
+	return nil
+}
@@ -0,0 +1,56 @@
+// Copyright (c) 2015, Roland Bali (roland.bali@spagettikod.se), Spagettikod
+// All rights reserved.
+//
+// Redistribution and use in source and binary forms, with or without modification,
+// are permitted provided that the following conditions are met:
+//
+// 1. Redistributions of source code must retain the above copyright notice, this
+//    list of conditions and the following disclaimer.
+//
+// 2. Redistributions in binary form must reproduce the above copyright notice, this
+//    list of conditions and the following disclaimer in the documentation and/or
+//    other materials provided with the distribution.
+//
+// 3. Neither the name of the copyright holder nor the names of its contributors may
+//    be used to endorse or promote products derived from this software without
+//    specific prior written permission.
+//
+// THIS SOFTWARE IS PROVIDED BY THE COPYRIGHT HOLDERS AND CONTRIBUTORS "AS IS" AND
+// ANY EXPRESS OR IMPLIED WARRANTIES, INCLUDING, BUT NOT LIMITED TO, THE IMPLIED
+// WARRANTIES OF MERCHANTABILITY AND FITNESS FOR A PARTICULAR PURPOSE ARE DISCLAIMED.
+// IN NO EVENT SHALL THE COPYRIGHT HOLDER OR CONTRIBUTORS BE LIABLE FOR ANY DIRECT,
+// INDIRECT, INCIDENTAL, SPECIAL, EXEMPLARY, OR CONSEQUENTIAL DAMAGES (INCLUDING, BUT
+// NOT LIMITED TO, PROCUREMENT OF SUBSTITUTE GOODS OR SERVICES; LOSS OF USE, DATA, OR
+// PROFITS; OR BUSINESS INTERRUPTION) HOWEVER CAUSED AND ON ANY THEORY OF LIABILITY,
+// WHETHER IN CONTRACT, STRICT LIABILITY, OR TORT (INCLUDING NEGLIGENCE OR OTHERWISE)
+// ARISING IN ANY WAY OUT OF THE USE OF THIS SOFTWARE, EVEN IF ADVISED OF THE
+// POSSIBILITY OF SUCH DAMAGE.
+
+package gotracer
+
+import (
+	"testing"
+	"time"
+)
+
+func TestWriteGuardStampsChangedRegistersOnly(t *testing.T) {
+	f := newFakeTracer()
+	tr := f.tracer(WithWriteGuard(NewWriteGuard(time.Hour)))
+	f.holding[0x906b] = 1
+	if err := writeRegisters(f, tr.cfg, 0x906b, []uint16{1, 2}); err != nil {
+		t.Fatal(err)
+	}
+	// 0x906b already held 1 and was not changed by the first write.
+	if err := writeRegisters(f, tr.cfg, 0x906b, []uint16{3, 2}); err != nil {
+		t.Fatalf("write of unchanged register refused: %v", err)
+	}
+	if err := writeRegisters(f, tr.cfg, 0x906b, []uint16{3, 2}); err != nil {
+		t.Fatalf("write of unchanged values: %v", err)
+	}
+	if n := len(f.writes()); n != 2 {
+		t.Errorf("got %d writes, want 2", n)
+	}
+	if err := writeRegisters(f, tr.cfg, 0x906b, []uint16{3, 4}); err != ErrWriteThrottled {
+		t.Errorf("got %v, want ErrWriteThrottled", err)
+	}
+}